@@ -0,0 +1,158 @@
+package aggregator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+)
+
+// State is the state of a backend instance: the data of its last successful
+// discovery, if any, and since when and why it fails
+type State struct {
+	Data    backends.BackendData
+	HasData bool
+	// Discovered is the time of the discovery of Data
+	Discovered time.Time
+	// Restored is set when the data was restored, like from a cache,
+	// instead of discovered
+	Restored bool
+	Failing  time.Time
+	Err      error
+	// Version is the version of the snapshot in which the state changed
+	// last, and DataVersion the one in which Data changed last: failed
+	// discoveries only change Version
+	Version     uint64
+	DataVersion uint64
+}
+
+// Snapshot is a consistent view of the states of every backend instance,
+// indexed by backend key. It must not be modified.
+type Snapshot struct {
+	Version uint64
+	States  map[string]State
+}
+
+// Aggregator stores the states of the backend instances. Every change
+// creates a new version of the snapshot and notifies the subscribers.
+type Aggregator struct {
+	mu      sync.RWMutex
+	version uint64
+	states  map[string]State
+	subs    map[chan struct{}]bool
+}
+
+// New creates an empty aggregator
+func New() *Aggregator {
+	return &Aggregator{
+		states: make(map[string]State),
+		subs:   make(map[chan struct{}]bool),
+	}
+}
+
+// Publish records a discovery of a backend. A failed discovery keeps the
+// data of the last successful one. Publish never blocks on subscribers.
+func (a *Aggregator) Publish(data backends.BackendData) {
+	key := config.BackendKey(data.Backend, data.ID)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s := a.states[key]
+	if data.Err != nil {
+		if s.Failing.IsZero() {
+			s.Failing = time.Now()
+		}
+		s.Err = data.Err
+		a.update(key, &s, false)
+		return
+	}
+
+	s = State{Data: data, HasData: true, Discovered: time.Now()}
+	a.update(key, &s, true)
+}
+
+// Restore records data which was not discovered by the running backend,
+// like cached data discovered at the given time, unless the backend
+// already published
+func (a *Aggregator) Restore(data backends.BackendData, discovered time.Time) bool {
+	key := config.BackendKey(data.Backend, data.ID)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.states[key]; ok {
+		return false
+	}
+	a.update(key, &State{Data: data, HasData: true, Discovered: discovered, Restored: true}, true)
+	return true
+}
+
+// Get returns the state of a backend instance
+func (a *Aggregator) Get(key string) (s State, ok bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	s, ok = a.states[key]
+	return
+}
+
+// Remove forgets the state of a backend instance
+func (a *Aggregator) Remove(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.states[key]; !ok {
+		return
+	}
+	delete(a.states, key)
+	a.version++
+	a.notify()
+}
+
+// Snapshot returns the current snapshot
+func (a *Aggregator) Snapshot() Snapshot {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	states := make(map[string]State, len(a.states))
+	for key, s := range a.states {
+		states[key] = s
+	}
+	return Snapshot{
+		Version: a.version,
+		States:  states,
+	}
+}
+
+// Subscribe returns a channel which receives a value when a new snapshot is
+// available. Notifications are coalesced: a slow subscriber only misses
+// intermediate snapshots.
+func (a *Aggregator) Subscribe() <-chan struct{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	a.subs[ch] = true
+	return ch
+}
+
+func (a *Aggregator) update(key string, s *State, dataChanged bool) {
+	a.version++
+	s.Version = a.version
+	if dataChanged {
+		s.DataVersion = a.version
+	}
+	a.states[key] = *s
+	a.notify()
+}
+
+func (a *Aggregator) notify() {
+	for ch := range a.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
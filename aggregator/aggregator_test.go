@@ -0,0 +1,57 @@
+package aggregator
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+)
+
+func TestPublishFailureKeepsData(t *testing.T) {
+	key := config.BackendKey("static", "a")
+	a := New()
+	updates := a.Subscribe()
+
+	a.Publish(backends.BackendData{Backend: "static", ID: "a", Jobs: []backends.JobConfig{{JobName: "a"}}})
+	ok := a.Snapshot().States[key]
+	<-updates
+
+	a.Publish(backends.BackendData{Backend: "static", ID: "a", Err: fmt.Errorf("boom")})
+	failed := a.Snapshot().States[key]
+	select {
+	case <-updates:
+	default:
+		t.Error("expected a notification for the failure")
+	}
+
+	if !failed.HasData || len(failed.Data.Jobs) != 1 {
+		t.Errorf("expected the failure to keep the last data, got %+v", failed.Data)
+	}
+	if failed.Failing.IsZero() || failed.Err == nil {
+		t.Errorf("expected the state to be failing")
+	}
+	if failed.Version <= ok.Version {
+		t.Errorf("expected the failure to change the version")
+	}
+	if failed.DataVersion != ok.DataVersion || !failed.Discovered.Equal(ok.Discovered) {
+		t.Errorf("expected the failure to keep the data version and discovery time")
+	}
+}
+
+func TestRestore(t *testing.T) {
+	discovered := time.Now().Add(-time.Minute)
+	a := New()
+	a.Publish(backends.BackendData{Backend: "static", ID: "a"})
+	if a.Restore(backends.BackendData{Backend: "static", ID: "a"}, discovered) {
+		t.Error("expected Restore to keep published data")
+	}
+	if !a.Restore(backends.BackendData{Backend: "static", ID: "b"}, discovered) {
+		t.Error("expected Restore to record data of a backend which did not publish")
+	}
+	s := a.Snapshot().States[config.BackendKey("static", "b")]
+	if !s.Restored || !s.Discovered.Equal(discovered) {
+		t.Errorf("unexpected restored state %+v", s)
+	}
+}
@@ -1,8 +1,8 @@
 package cattle
 
 import (
+	"context"
 	"fmt"
-	"reflect"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -11,15 +11,26 @@ import (
 	"github.com/cryptobioz/prometheus-service-discovery/backends"
 )
 
+func init() {
+	backends.Register("cattle", func() backends.BackendInterface {
+		return &Cattle{}
+	})
+}
+
 // Cattle is a struct which stores the Cattle configuration parameters
 type Cattle struct {
-	Name            string        `yaml:"name"`
-	Endpoint        string        `yaml:"endpoint"`
-	AccessKey       string        `yaml:"access_key"`
-	SecretKey       string        `yaml:"secret_key"`
-	Timeout         time.Duration `yaml:"timeout,omitempty"`
-	RefreshInterval time.Duration `yaml:"refresh_interval,omitempty"`
+	Name            string           `yaml:"name"`
+	Endpoint        string           `yaml:"endpoint"`
+	AccessKey       string           `yaml:"access_key,omitempty"`
+	AccessKeyFile   string           `yaml:"access_key_file,omitempty"`
+	SecretKey       string           `yaml:"secret_key,omitempty"`
+	SecretKeyFile   string           `yaml:"secret_key_file,omitempty"`
+	Timeout         time.Duration    `yaml:"timeout,omitempty"`
+	RefreshInterval time.Duration    `yaml:"refresh_interval,omitempty"`
+	Backoff         backends.Backoff `yaml:"backoff,omitempty"`
 	client          *client.RancherClient
+	accessKey       string
+	secretKey       string
 }
 
 type prometheusServer struct {
@@ -50,8 +61,8 @@ func (cfg *Cattle) New() (err error) {
 
 	cfg.client, err = client.NewRancherClient(&client.ClientOpts{
 		Url:       cfg.Endpoint,
-		AccessKey: cfg.AccessKey,
-		SecretKey: cfg.SecretKey,
+		AccessKey: cfg.accessKey,
+		SecretKey: cfg.secretKey,
 		Timeout:   cfg.Timeout * time.Second,
 	})
 	if err != nil {
@@ -60,29 +71,32 @@ func (cfg *Cattle) New() (err error) {
 	return
 }
 
-// Start starts the Cattle service discovery
-func (cfg *Cattle) Start(cattleData chan backends.BackendData) {
-	var data backends.BackendData
-	for {
-		log.WithFields(log.Fields{
-			"backend": "cattle",
-			"id":      cfg.Name,
-		}).Debugf("Sleeping for %ds", cfg.RefreshInterval)
-		time.Sleep(cfg.RefreshInterval * time.Second)
+// Schedule returns how often Rancher is queried
+func (cfg *Cattle) Schedule() backends.Schedule {
+	return backends.Schedule{
+		Interval: cfg.RefreshInterval * time.Second,
+		Timeout:  cfg.Timeout * time.Second,
+		Backoff:  cfg.Backoff,
+	}
+}
 
-		targets, err := cfg.getTargets()
-		if err != nil {
-			log.Errorf("failed to retrieve Prometheus servers: %s", err)
-			continue
-		}
+// Discover retrieves the Prometheus servers from Rancher once
+func (cfg *Cattle) Discover(ctx context.Context) ([]backends.JobConfig, error) {
+	targets, err := cfg.getTargetsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve Prometheus servers: %s", err)
+	}
+	return cfg.formatTargets(targets)
+}
 
-		output, _ := cfg.formatTargets(targets)
+// Check validates the Cattle configuration
+func (cfg *Cattle) Check() error {
+	return cfg.setupConfig()
+}
 
-		if !reflect.DeepEqual(output, data) {
-			data = output
-			cattleData <- data
-		}
-	}
+// Secrets returns the resolved access and secret keys
+func (cfg *Cattle) Secrets() []string {
+	return []string{cfg.accessKey, cfg.secretKey}
 }
 
 func (cfg *Cattle) setupConfig() error {
@@ -94,6 +108,11 @@ func (cfg *Cattle) setupConfig() error {
 		cfg.Timeout = 30
 	}
 
+	err := cfg.Backoff.Setup()
+	if err != nil {
+		return err
+	}
+
 	if cfg.Endpoint == "" {
 		return fmt.Errorf("field `endpoint` is required")
 	}
@@ -102,16 +121,46 @@ func (cfg *Cattle) setupConfig() error {
 		return fmt.Errorf("field `name` is required")
 	}
 
-	if cfg.AccessKey == "" {
+	cfg.accessKey, err = backends.Secret("access_key", cfg.AccessKey, cfg.AccessKeyFile)
+	if err != nil {
+		return err
+	}
+	if cfg.accessKey == "" {
 		return fmt.Errorf("field `access_key` is required")
 	}
 
-	if cfg.SecretKey == "" {
+	cfg.secretKey, err = backends.Secret("secret_key", cfg.SecretKey, cfg.SecretKeyFile)
+	if err != nil {
+		return err
+	}
+	if cfg.secretKey == "" {
 		return fmt.Errorf("field `secret_key` is required")
 	}
 	return nil
 }
 
+// getTargetsContext runs getTargets and returns as soon as ctx is cancelled,
+// as the Rancher client does not support contexts
+func (cfg *Cattle) getTargetsContext(ctx context.Context) ([]prometheusServer, error) {
+	type result struct {
+		targets []prometheusServer
+		err     error
+	}
+
+	res := make(chan result, 1)
+	go func() {
+		targets, err := cfg.getTargets()
+		res <- result{targets, err}
+	}()
+
+	select {
+	case r := <-res:
+		return r.targets, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 func (cfg *Cattle) getTargets() (targets []prometheusServer, err error) {
 	stacks, err := cfg.client.Stack.List(&client.ListOpts{
 		Filters: map[string]interface{}{
@@ -165,7 +214,7 @@ func (cfg *Cattle) getTargets() (targets []prometheusServer, err error) {
 	return
 }
 
-func (cfg *Cattle) formatTargets(targets []prometheusServer) (backends.BackendData, error) {
+func (cfg *Cattle) formatTargets(targets []prometheusServer) ([]backends.JobConfig, error) {
 	jobs := []backends.JobConfig{}
 
 	for _, target := range targets {
@@ -188,17 +237,12 @@ func (cfg *Cattle) formatTargets(targets []prometheusServer) (backends.BackendDa
 		}
 
 		if target.username != "" && target.password != "" {
-			job.BasicAuth = map[string]string{
-				"username": target.username,
-				"password": target.password,
+			job.BasicAuth = &backends.BasicAuth{
+				Username: target.username,
+				Password: target.password,
 			}
 		}
 		jobs = append(jobs, job)
 	}
-	data := backends.BackendData{
-		ID:      cfg.Name,
-		Backend: "cattle",
-		Jobs:    jobs,
-	}
-	return data, nil
+	return jobs, nil
 }
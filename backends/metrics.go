@@ -0,0 +1,115 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cryptobioz/prometheus-service-discovery/metrics"
+)
+
+var (
+	discoveryDuration = metrics.NewHistogramVec(
+		"psd_backend_discovery_duration_seconds",
+		"Duration of the backend discoveries.",
+		metrics.DefBuckets,
+		"backend", "id",
+	)
+	refreshes = metrics.NewCounterVec(
+		"psd_backend_refreshes_total",
+		"Number of discoveries run by the backend.",
+		"backend", "id",
+	)
+	refreshErrors = metrics.NewCounterVec(
+		"psd_backend_errors_total",
+		"Number of discoveries which failed.",
+		"backend", "id",
+	)
+	targetsDiscovered = metrics.NewGaugeVec(
+		"psd_backend_targets",
+		"Number of targets returned by the last successful discovery.",
+		"backend", "id",
+	)
+	lastSuccess = metrics.NewGaugeVec(
+		"psd_backend_last_success_timestamp_seconds",
+		"Timestamp of the last successful discovery.",
+		"backend", "id",
+	)
+	breakerOpen = metrics.NewGaugeVec(
+		"psd_backend_circuit_breaker_open",
+		"Whether the discoveries of the backend are paused after too many failures.",
+		"backend", "id",
+	)
+	pollInterval = metrics.NewGaugeVec(
+		"psd_backend_poll_interval_seconds",
+		"Duration to wait before the next discovery, backoff and jitter included.",
+		"backend", "id",
+	)
+)
+
+// Discover runs a single discovery of the backend, cancelled after timeout
+// if it is not 0, and records its metrics. A panic of the backend is
+// returned as an error. Nothing is recorded if ctx was cancelled, as the
+// backend is being stopped, but a discovery which timed out is a failure.
+func Discover(ctx context.Context, b BackendInterface, timeout time.Duration) ([]JobConfig, error) {
+	name, id := b.GetName(), b.GetID()
+
+	dctx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		dctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	jobs, err := safeDiscover(dctx, b)
+	if ctx.Err() != nil {
+		return jobs, err
+	}
+	if err != nil && dctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("discovery timed out after %s: %s", timeout, err)
+	}
+
+	discoveryDuration.Observe(time.Since(start).Seconds(), name, id)
+	refreshes.Inc(name, id)
+	if err != nil {
+		refreshErrors.Inc(name, id)
+		recordFailure(name, id, err)
+		return jobs, err
+	}
+
+	n := CountTargets(jobs)
+	refreshErrors.Add(0, name, id)
+	targetsDiscovered.Set(float64(n), name, id)
+	lastSuccess.Set(float64(time.Now().Unix()), name, id)
+	recordSuccess(name, id, n)
+	return jobs, nil
+}
+
+func safeDiscover(ctx context.Context, b BackendInterface) (jobs []JobConfig, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			jobs, err = nil, fmt.Errorf("discovery panicked: %v", r)
+		}
+	}()
+	return b.Discover(ctx)
+}
+
+// Forget removes the metrics and the status of a backend instance which is
+// no longer configured
+func Forget(name, id string) {
+	forgetStatus(name, id)
+	for _, v := range []*metrics.Vec{discoveryDuration, refreshes, refreshErrors, targetsDiscovered, lastSuccess, breakerOpen, pollInterval} {
+		v.Delete(name, id)
+	}
+}
+
+// CountTargets returns the number of targets of the given jobs
+func CountTargets(jobs []JobConfig) (n int) {
+	for _, job := range jobs {
+		for _, sc := range job.StaticConfigs {
+			n += len(sc.Targets)
+		}
+	}
+	return
+}
@@ -0,0 +1,57 @@
+package backends
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingBackend is a backend whose discoveries block until their context
+// is done
+type blockingBackend struct {
+	id string
+}
+
+func (blockingBackend) New() error { return nil }
+func (blockingBackend) Discover(ctx context.Context) ([]JobConfig, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+func (blockingBackend) GetName() string { return "blocking" }
+func (b blockingBackend) GetID() string { return b.id }
+
+func TestDiscoverTimeout(t *testing.T) {
+	b := blockingBackend{"timeout"}
+	defer Forget(b.GetName(), b.GetID())
+
+	_, err := Discover(context.Background(), b, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+
+	s := GetStatus(b.GetName(), b.GetID())
+	if s.ConsecutiveFailures != 1 || s.LastError != err.Error() {
+		t.Errorf("expected the timeout to be recorded as a failure, got %+v", s)
+	}
+}
+
+func TestDiscoverCancelled(t *testing.T) {
+	b := blockingBackend{"cancelled"}
+	defer Forget(b.GetName(), b.GetID())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err := Discover(ctx, b, time.Minute)
+	if err != context.Canceled {
+		t.Fatalf("expected the discovery to be cancelled, got %v", err)
+	}
+
+	s := GetStatus(b.GetName(), b.GetID())
+	if s.ConsecutiveFailures != 0 || s.LastError != "" {
+		t.Errorf("expected a cancelled discovery not to be recorded, got %+v", s)
+	}
+}
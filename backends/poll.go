@@ -0,0 +1,223 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DefaultTimeout is the maximum duration of a discovery whose schedule has
+// no timeout
+const DefaultTimeout = 30 * time.Second
+
+// Schedule stores when a backend is discovered: every Interval, or a single
+// time if Once is set, in which case only failed discoveries are retried.
+// Each discovery is cancelled after Timeout.
+type Schedule struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	Once     bool
+	Backoff  Backoff
+}
+
+// DefaultSchedule is the schedule of the backends which do not implement
+// Scheduler
+var DefaultSchedule = Schedule{Interval: time.Minute}
+
+// Backoff stores how a backend spaces its discoveries. Intervals are
+// randomized by +/- Jitter (a fraction of the interval), doubled on every
+// consecutive failure up to MaxInterval seconds, and the backend is paused
+// for BreakerPause seconds once BreakerThreshold consecutive discoveries
+// failed.
+type Backoff struct {
+	Jitter           float64       `yaml:"jitter,omitempty"`
+	MaxInterval      time.Duration `yaml:"max_interval,omitempty"`
+	BreakerThreshold int           `yaml:"breaker_threshold,omitempty"`
+	BreakerPause     time.Duration `yaml:"breaker_pause,omitempty"`
+}
+
+// Setup applies the default settings and validates them
+func (b *Backoff) Setup() error {
+	if b.Jitter == 0 {
+		b.Jitter = 0.1
+	}
+	if b.Jitter < 0 || b.Jitter > 1 {
+		return fmt.Errorf("field `backoff.jitter` must be between 0 and 1")
+	}
+
+	if b.MaxInterval == 0 {
+		b.MaxInterval = 300
+	}
+	if b.MaxInterval < 0 {
+		return fmt.Errorf("field `backoff.max_interval` must be positive")
+	}
+
+	if b.BreakerThreshold == 0 {
+		b.BreakerThreshold = 10
+	}
+	if b.BreakerThreshold < 0 {
+		return fmt.Errorf("field `backoff.breaker_threshold` must be positive")
+	}
+
+	if b.BreakerPause == 0 {
+		b.BreakerPause = 600
+	}
+	if b.BreakerPause < 0 {
+		return fmt.Errorf("field `backoff.breaker_pause` must be positive")
+	}
+	return nil
+}
+
+// Poller schedules the discoveries of a backend
+type Poller struct {
+	backend  BackendInterface
+	interval time.Duration
+	backoff  Backoff
+	failures int
+	open     bool
+	rand     *rand.Rand
+	logger   *log.Entry
+}
+
+// NewPoller creates a poller which runs the discoveries of the backend every
+// interval, according to the backoff settings. Invalid backoff settings are
+// replaced by the default ones.
+func NewPoller(b BackendInterface, interval time.Duration, backoff Backoff) *Poller {
+	name, id := b.GetName(), b.GetID()
+	logger := log.WithFields(log.Fields{
+		"backend": name,
+		"id":      id,
+	})
+
+	err := backoff.Setup()
+	if err != nil {
+		logger.Errorf("Invalid backoff settings, using the default ones: %s", err)
+		backoff = Backoff{}
+		backoff.Setup()
+	}
+
+	breakerOpen.Set(0, name, id)
+	return &Poller{
+		backend:  b,
+		interval: interval,
+		backoff:  backoff,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		logger:   logger,
+	}
+}
+
+// Next returns the duration to wait before the next discovery
+func (p *Poller) Next() time.Duration {
+	d := p.interval
+	if p.open {
+		d = p.backoff.BreakerPause * time.Second
+	} else if p.failures > 0 {
+		max := p.backoff.MaxInterval * time.Second
+		if max < p.interval {
+			max = p.interval
+		}
+		for i := 0; i < p.failures && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+	}
+
+	jitter := p.backoff.Jitter * (2*p.rand.Float64() - 1)
+	return time.Duration(float64(d) * (1 + jitter))
+}
+
+// Wait sleeps until the next discovery. It returns false if ctx was
+// cancelled in the meantime.
+func (p *Poller) Wait(ctx context.Context) bool {
+	d := p.Next()
+	pollInterval.Set(d.Seconds(), p.backend.GetName(), p.backend.GetID())
+	p.logger.Debugf("Sleeping for %s", d.Round(time.Millisecond))
+	if !Sleep(ctx, d) {
+		return false
+	}
+
+	if p.open {
+		p.logger.Info("Circuit breaker half-open, trying a discovery")
+	}
+	return true
+}
+
+// Success records a successful discovery and closes the circuit breaker
+func (p *Poller) Success() {
+	if p.open {
+		p.logger.Info("Circuit breaker closed")
+		breakerOpen.Set(0, p.backend.GetName(), p.backend.GetID())
+	}
+	p.failures = 0
+	p.open = false
+}
+
+// Failure records a failed discovery, and opens the circuit breaker after
+// too many consecutive failures
+func (p *Poller) Failure() {
+	p.failures++
+	if p.failures < p.backoff.BreakerThreshold {
+		return
+	}
+
+	if !p.open {
+		p.logger.Warnf("Circuit breaker opened after %d consecutive failures, pausing discoveries for %ds", p.failures, p.backoff.BreakerPause)
+		breakerOpen.Set(1, p.backend.GetName(), p.backend.GetID())
+	}
+	p.open = true
+}
+
+// poll runs the discoveries of the backend until ctx is cancelled. A
+// discovery is published when it differs from the previous one; the first
+// failure after a successful discovery is published too.
+func poll(ctx context.Context, b BackendInterface, p Publisher) {
+	schedule := DefaultSchedule
+	if s, ok := b.(Scheduler); ok {
+		schedule = s.Schedule()
+	}
+	if schedule.Timeout == 0 {
+		schedule.Timeout = DefaultTimeout
+	}
+
+	interval := schedule.Interval
+	if schedule.Once {
+		// Only failures are retried
+		interval = time.Second
+	}
+	poller := NewPoller(b, interval, schedule.Backoff)
+
+	var hash string
+	for {
+		jobs, err := Discover(ctx, b, schedule.Timeout)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			poller.Failure()
+			poller.logger.Errorf("Discovery failed: %s", err)
+			if hash != failedHash {
+				hash = failedHash
+				p.Publish(BackendData{ID: b.GetID(), Backend: b.GetName(), Err: err})
+			}
+		} else {
+			poller.Success()
+			if h := Hash(jobs); h != hash {
+				hash = h
+				p.Publish(BackendData{ID: b.GetID(), Backend: b.GetName(), Jobs: jobs})
+			}
+			if schedule.Once {
+				return
+			}
+		}
+
+		if !poller.Wait(ctx) {
+			return
+		}
+	}
+}
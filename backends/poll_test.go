@@ -0,0 +1,113 @@
+package backends
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeBackend struct{}
+
+func (fakeBackend) New() error                                    { return nil }
+func (fakeBackend) Discover(context.Context) ([]JobConfig, error) { return nil, nil }
+func (fakeBackend) GetName() string                               { return "fake" }
+func (fakeBackend) GetID() string                                 { return "test" }
+
+func newTestPoller(interval time.Duration, backoff Backoff) *Poller {
+	p := NewPoller(fakeBackend{}, interval, backoff)
+	p.backoff.Jitter = 0
+	return p
+}
+
+func TestPollerNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		backoff  Backoff
+		failures int
+		expected time.Duration
+	}{
+		{"no failure", time.Minute, Backoff{}, 0, time.Minute},
+		{"one failure", time.Minute, Backoff{}, 1, 2 * time.Minute},
+		{"two failures", time.Minute, Backoff{}, 2, 4 * time.Minute},
+		{"capped", time.Minute, Backoff{}, 3, 5 * time.Minute},
+		{"capped after many failures", time.Minute, Backoff{BreakerThreshold: 100}, 80, 5 * time.Minute},
+		{"interval above the cap", 10 * time.Minute, Backoff{}, 2, 10 * time.Minute},
+		{"custom cap", time.Second, Backoff{MaxInterval: 10}, 5, 10 * time.Second},
+		{"breaker open", time.Minute, Backoff{BreakerThreshold: 3, BreakerPause: 60 * 60}, 3, time.Hour},
+	}
+
+	for _, test := range tests {
+		p := newTestPoller(test.interval, test.backoff)
+		for i := 0; i < test.failures; i++ {
+			p.Failure()
+		}
+		if d := p.Next(); d != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, d)
+		}
+	}
+}
+
+func TestPollerBreaker(t *testing.T) {
+	p := newTestPoller(time.Minute, Backoff{BreakerThreshold: 2, BreakerPause: 600})
+
+	p.Failure()
+	if p.open {
+		t.Fatal("expected the breaker to be closed before the threshold")
+	}
+	p.Failure()
+	if !p.open {
+		t.Fatal("expected the breaker to open at the threshold")
+	}
+
+	// A failed half-open discovery keeps the breaker open
+	p.Failure()
+	if d := p.Next(); !p.open || d != 10*time.Minute {
+		t.Errorf("expected the breaker to stay open for 10m, got open=%v and %s", p.open, d)
+	}
+
+	p.Success()
+	if d := p.Next(); p.open || d != time.Minute {
+		t.Errorf("expected the breaker to close and the interval to reset, got open=%v and %s", p.open, d)
+	}
+}
+
+func TestPollerJitter(t *testing.T) {
+	p := NewPoller(fakeBackend{}, time.Minute, Backoff{Jitter: 0.5})
+	for i := 0; i < 100; i++ {
+		if d := p.Next(); d < 30*time.Second || d > 90*time.Second {
+			t.Fatalf("expected a duration between 30s and 1m30s, got %s", d)
+		}
+	}
+}
+
+func TestBackoffSetup(t *testing.T) {
+	tests := []struct {
+		backoff Backoff
+		valid   bool
+	}{
+		{Backoff{}, true},
+		{Backoff{Jitter: 1, MaxInterval: 60, BreakerThreshold: 1, BreakerPause: 1}, true},
+		{Backoff{Jitter: -0.1}, false},
+		{Backoff{Jitter: 1.5}, false},
+		{Backoff{MaxInterval: -1}, false},
+		{Backoff{BreakerThreshold: -1}, false},
+		{Backoff{BreakerPause: -1}, false},
+	}
+
+	for _, test := range tests {
+		if err := test.backoff.Setup(); (err == nil) != test.valid {
+			t.Errorf("%+v: expected valid=%v, got error %v", test.backoff, test.valid, err)
+		}
+	}
+}
+
+func TestNewPollerInvalidBackoff(t *testing.T) {
+	p := newTestPoller(time.Minute, Backoff{BreakerThreshold: 1, BreakerPause: -1})
+	for i := 0; i < 10; i++ {
+		p.Failure()
+	}
+	if d := p.Next(); !p.open || d != 10*time.Minute {
+		t.Errorf("expected the default breaker settings, got open=%v and %s", p.open, d)
+	}
+}
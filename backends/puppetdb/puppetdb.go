@@ -1,6 +1,7 @@
 package puppetdb
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -8,29 +9,38 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"reflect"
 	"strings"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
-
 	"github.com/cryptobioz/prometheus-service-discovery/backends"
 )
 
+func init() {
+	backends.Register("puppetdb", func() backends.BackendInterface {
+		return &PuppetDB{}
+	})
+}
+
 // PuppetDB is a struct which stores the PuppetDB configuration parameters
 type PuppetDB struct {
-	Name            string        `yaml:"name"`
-	URL             string        `yaml:"url"`
-	CertFile        string        `yaml:"certfile,omitempty"`
-	KeyFile         string        `yaml:"keyfile,omitempty"`
-	CACertFile      string        `yaml:"cacert,omitempty"`
-	SSLSkipVerify   bool          `yaml:"ssl_skip_verify,omitempty"`
-	Query           string        `yaml:"query"`
-	Output          string        `yaml:"output"`
-	OutputFile      string        `yaml:"output_file"`
-	Timeout         int           `yaml:"timeout,omitempty"`
-	RefreshInterval time.Duration `yaml:"refresh_interval,omitempty"`
+	Name            string           `yaml:"name"`
+	URL             string           `yaml:"url"`
+	CertFile        string           `yaml:"certfile,omitempty"`
+	KeyFile         string           `yaml:"keyfile,omitempty"`
+	CACertFile      string           `yaml:"cacert,omitempty"`
+	SSLSkipVerify   bool             `yaml:"ssl_skip_verify,omitempty"`
+	Username        string           `yaml:"username,omitempty"`
+	Password        string           `yaml:"password,omitempty"`
+	PasswordFile    string           `yaml:"password_file,omitempty"`
+	Query           string           `yaml:"query"`
+	Output          string           `yaml:"output"`
+	OutputFile      string           `yaml:"output_file"`
+	Timeout         int              `yaml:"timeout,omitempty"`
+	RefreshInterval time.Duration    `yaml:"refresh_interval,omitempty"`
+	Backoff         backends.Backoff `yaml:"backoff,omitempty"`
 	client          *http.Client
+	username        string
+	password        string
 }
 
 type node struct {
@@ -53,17 +63,58 @@ func (cfg *PuppetDB) GetID() string {
 	return cfg.Name
 }
 
-// New creates a new PuppetDB client
-func (cfg *PuppetDB) New() (err error) {
+// Check validates the PuppetDB configuration
+func (cfg *PuppetDB) Check() error {
+	if cfg.URL == "" {
+		return fmt.Errorf("field `url` is required")
+	}
+
 	puppetDBUrl, err := url.Parse(cfg.URL)
 	if err != nil {
-		return
+		return err
 	}
 
 	if puppetDBUrl.Scheme != "http" && puppetDBUrl.Scheme != "https" {
 		return fmt.Errorf("%s is not a valid http scheme", puppetDBUrl.Scheme)
 	}
 
+	if cfg.Query == "" {
+		return fmt.Errorf("field `query` is required")
+	}
+
+	err = cfg.Backoff.Setup()
+	if err != nil {
+		return err
+	}
+
+	cfg.username, err = backends.Secret("username", cfg.Username, "")
+	if err != nil {
+		return err
+	}
+	cfg.password, err = backends.Secret("password", cfg.Password, cfg.PasswordFile)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Secrets returns the resolved basic auth credentials
+func (cfg *PuppetDB) Secrets() []string {
+	return []string{cfg.username, cfg.password}
+}
+
+// New creates a new PuppetDB client
+func (cfg *PuppetDB) New() (err error) {
+	err = cfg.Check()
+	if err != nil {
+		return
+	}
+
+	puppetDBUrl, err := url.Parse(cfg.URL)
+	if err != nil {
+		return
+	}
+
 	var transport *http.Transport
 	if puppetDBUrl.Scheme == "https" {
 		// Load client cert
@@ -98,14 +149,6 @@ func (cfg *PuppetDB) New() (err error) {
 		cfg.RefreshInterval = 5
 	}
 
-	if cfg.Query == "" {
-		return fmt.Errorf("field `query` is required")
-	}
-
-	if cfg.URL == "" {
-		return fmt.Errorf("field `url` is required")
-	}
-
 	if cfg.OutputFile != "" {
 		cfg.Output = "file"
 	}
@@ -116,46 +159,42 @@ func (cfg *PuppetDB) New() (err error) {
 	return
 }
 
-// Start starts the PuppetDB service discovery
-func (cfg *PuppetDB) Start(puppetDBData chan backends.BackendData) {
-	var data backends.BackendData
-	for {
-		log.WithFields(log.Fields{
-			"backend": "puppetdb",
-		}).Debugf("Sleeping for %ds", cfg.RefreshInterval)
-		time.Sleep(cfg.RefreshInterval * time.Second)
-
-		jobs, err := cfg.getTargets()
-		if err != nil {
-			log.Errorf("failed to get exporters: %s", err)
-			continue
-		}
-		output := backends.BackendData{
-			ID:      cfg.Name,
-			Backend: "puppetdb",
-			Jobs:    jobs.([]backends.JobConfig),
-		}
+// Schedule returns how often PuppetDB is queried
+func (cfg *PuppetDB) Schedule() backends.Schedule {
+	return backends.Schedule{
+		Interval: cfg.RefreshInterval * time.Second,
+		Timeout:  time.Duration(cfg.Timeout) * time.Second,
+		Backoff:  cfg.Backoff,
+	}
+}
 
-		if !reflect.DeepEqual(output, data) {
-			data = output
-			puppetDBData <- data
-		}
+// Discover queries PuppetDB once and returns the exporters as jobs
+func (cfg *PuppetDB) Discover(ctx context.Context) ([]backends.JobConfig, error) {
+	jobs, err := cfg.getTargets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exporters: %s", err)
 	}
+	return jobs.([]backends.JobConfig), nil
 }
 
-func (cfg *PuppetDB) getNodes() (nodes []node, err error) {
+func (cfg *PuppetDB) getNodes(ctx context.Context) (nodes []node, err error) {
 	form := strings.NewReader(fmt.Sprintf("{\"query\":\"%s\"}", cfg.Query))
 	puppetDBUrl := fmt.Sprintf("%s/pdb/query/v4", cfg.URL)
 	req, err := http.NewRequest("POST", puppetDBUrl, form)
 	if err != nil {
 		return
 	}
+	req = req.WithContext(ctx)
 	req.Header.Add("Content-Type", "application/json")
+	if cfg.username != "" {
+		req.SetBasicAuth(cfg.username, cfg.password)
+	}
 
 	resp, err := cfg.client.Do(req)
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -166,10 +205,10 @@ func (cfg *PuppetDB) getNodes() (nodes []node, err error) {
 	return
 }
 
-func (cfg *PuppetDB) getTargets() (interface{}, error) {
+func (cfg *PuppetDB) getTargets(ctx context.Context) (interface{}, error) {
 	fileSdConfig := []backends.StaticConfig{}
 
-	nodes, err := cfg.getNodes()
+	nodes, err := cfg.getNodes(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get nodes: %s", err)
 	}
@@ -0,0 +1,50 @@
+package backends
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory creates a new, unconfigured backend
+type Factory func() BackendInterface
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a backend available under the given type name. It is
+// meant to be called from the init function of the backend's package and
+// panics if the name is already registered.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("backend `%s` is already registered", name))
+	}
+	factories[name] = factory
+}
+
+// Lookup returns the factory registered under the given type name
+func Lookup(name string) (factory Factory, ok bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	factory, ok = factories[name]
+	return
+}
+
+// Names returns the sorted list of registered backend types
+func Names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,144 @@
+package backends
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cryptobioz/prometheus-service-discovery/relabel"
+)
+
+// addressLabel exposes the target's address to the relabel configs
+const addressLabel = "__address__"
+
+// tmpLabelPrefix is the prefix of the temporary labels, which are removed
+// once relabeling is done
+const tmpLabelPrefix = "__tmp"
+
+// StaleLabel is set on the targets of a failing backend which are served
+// from its last successful discovery
+const StaleLabel = "__meta_psd_stale"
+
+// Relabel applies the relabel configs to every target of the jobs. The
+// target is exposed as the `__address__` label; targets whose address
+// becomes empty are dropped, and targets which end up with the same labels
+// are grouped in the same static config.
+func Relabel(jobs []JobConfig, cfgs []relabel.Config) []JobConfig {
+	if len(cfgs) == 0 {
+		return jobs
+	}
+
+	relabeled := make([]JobConfig, 0, len(jobs))
+	for _, job := range jobs {
+		var (
+			staticConfigs []StaticConfig
+			groups        = make(map[string]int)
+		)
+		for _, sc := range job.StaticConfigs {
+			for _, target := range sc.Targets {
+				labels := make(map[string]string, len(sc.Labels)+1)
+				for k, v := range sc.Labels {
+					labels[k] = v
+				}
+				labels[addressLabel] = target
+
+				labels = relabel.Process(labels, cfgs...)
+				if labels == nil {
+					continue
+				}
+
+				address := labels[addressLabel]
+				delete(labels, addressLabel)
+				for k := range labels {
+					if strings.HasPrefix(k, tmpLabelPrefix) {
+						delete(labels, k)
+					}
+				}
+				if address == "" {
+					continue
+				}
+
+				key := labelsKey(labels)
+				if i, ok := groups[key]; ok {
+					staticConfigs[i].Targets = append(staticConfigs[i].Targets, address)
+					continue
+				}
+				groups[key] = len(staticConfigs)
+				staticConfigs = append(staticConfigs, StaticConfig{
+					Targets: []string{address},
+					Labels:  labels,
+				})
+			}
+		}
+
+		job.StaticConfigs = staticConfigs
+		relabeled = append(relabeled, job)
+	}
+	return relabeled
+}
+
+func labelsKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"\xff"+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\xfe")
+}
+
+// InjectLabels adds the labels to every static config of the jobs. When a
+// static config already has one of the labels, its own value is kept unless
+// override is true.
+func InjectLabels(jobs []JobConfig, labels map[string]string, override bool) []JobConfig {
+	if len(labels) == 0 {
+		return jobs
+	}
+
+	injected := make([]JobConfig, 0, len(jobs))
+	for _, job := range jobs {
+		staticConfigs := make([]StaticConfig, 0, len(job.StaticConfigs))
+		for _, sc := range job.StaticConfigs {
+			merged := make(map[string]string, len(sc.Labels)+len(labels))
+			for k, v := range labels {
+				merged[k] = v
+			}
+			for k, v := range sc.Labels {
+				if _, ok := labels[k]; ok && override {
+					continue
+				}
+				merged[k] = v
+			}
+			staticConfigs = append(staticConfigs, StaticConfig{
+				Targets: sc.Targets,
+				Labels:  merged,
+			})
+		}
+
+		job.StaticConfigs = staticConfigs
+		injected = append(injected, job)
+	}
+	return injected
+}
+
+// MarkStale returns a copy of the jobs whose targets are labeled with
+// StaleLabel
+func MarkStale(jobs []JobConfig) []JobConfig {
+	marked := make([]JobConfig, 0, len(jobs))
+	for _, job := range jobs {
+		staticConfigs := make([]StaticConfig, 0, len(job.StaticConfigs))
+		for _, sc := range job.StaticConfigs {
+			labels := make(map[string]string, len(sc.Labels)+1)
+			for k, v := range sc.Labels {
+				labels[k] = v
+			}
+			labels[StaleLabel] = "true"
+			staticConfigs = append(staticConfigs, StaticConfig{
+				Targets: sc.Targets,
+				Labels:  labels,
+			})
+		}
+
+		job.StaticConfigs = staticConfigs
+		marked = append(marked, job)
+	}
+	return marked
+}
@@ -0,0 +1,114 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/cryptobioz/prometheus-service-discovery/relabel"
+)
+
+func parseRelabel(t *testing.T, y string) []relabel.Config {
+	var cfgs []relabel.Config
+	err := yaml.Unmarshal([]byte(y), &cfgs)
+	if err != nil {
+		t.Fatalf("failed to parse relabel configs: %s", err)
+	}
+	return cfgs
+}
+
+func TestRelabel(t *testing.T) {
+	jobs := []JobConfig{{
+		JobName: "a",
+		StaticConfigs: []StaticConfig{
+			{Targets: []string{"h1:1", "h2:1"}, Labels: map[string]string{"env": "prod"}},
+			{Targets: []string{"h3:1"}, Labels: map[string]string{"env": "dev"}},
+		},
+	}}
+
+	tests := []struct {
+		name     string
+		cfgs     string
+		expected []StaticConfig
+	}{
+		{
+			name: "address is rewritten",
+			cfgs: `
+- source_labels: [__address__]
+  regex: (.*):1
+  target_label: __address__
+  replacement: $1:9100`,
+			expected: []StaticConfig{
+				{Targets: []string{"h1:9100", "h2:9100"}, Labels: map[string]string{"env": "prod"}},
+				{Targets: []string{"h3:9100"}, Labels: map[string]string{"env": "dev"}},
+			},
+		},
+		{
+			name: "targets with an empty address are dropped",
+			cfgs: `
+- source_labels: [env]
+  regex: dev
+  target_label: __address__
+  replacement: ""`,
+			expected: []StaticConfig{
+				{Targets: []string{"h1:1", "h2:1"}, Labels: map[string]string{"env": "prod"}},
+			},
+		},
+		{
+			name: "dropped targets",
+			cfgs: `
+- source_labels: [__address__]
+  regex: h1:1
+  action: drop`,
+			expected: []StaticConfig{
+				{Targets: []string{"h2:1"}, Labels: map[string]string{"env": "prod"}},
+				{Targets: []string{"h3:1"}, Labels: map[string]string{"env": "dev"}},
+			},
+		},
+		{
+			name: "temporary labels are removed",
+			cfgs: `
+- source_labels: [__address__]
+  regex: (.*):1
+  target_label: __tmp_host
+- source_labels: [__tmp_host]
+  target_label: host`,
+			expected: []StaticConfig{
+				{Targets: []string{"h1:1"}, Labels: map[string]string{"env": "prod", "host": "h1"}},
+				{Targets: []string{"h2:1"}, Labels: map[string]string{"env": "prod", "host": "h2"}},
+				{Targets: []string{"h3:1"}, Labels: map[string]string{"env": "dev", "host": "h3"}},
+			},
+		},
+		{
+			name: "targets with the same labels are grouped",
+			cfgs: `
+- regex: env
+  action: labeldrop`,
+			expected: []StaticConfig{
+				{Targets: []string{"h1:1", "h2:1", "h3:1"}, Labels: map[string]string{}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		relabeled := Relabel(jobs, parseRelabel(t, test.cfgs))
+		if len(relabeled) != 1 || relabeled[0].JobName != "a" {
+			t.Fatalf("%s: unexpected jobs %+v", test.name, relabeled)
+		}
+		if !reflect.DeepEqual(relabeled[0].StaticConfigs, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, relabeled[0].StaticConfigs)
+		}
+	}
+
+	if jobs[0].StaticConfigs[0].Labels["env"] != "prod" || len(jobs[0].StaticConfigs[0].Labels) != 1 {
+		t.Errorf("expected the jobs to be unchanged, got %+v", jobs)
+	}
+}
+
+func TestRelabelWithoutConfigs(t *testing.T) {
+	jobs := []JobConfig{{JobName: "a", StaticConfigs: []StaticConfig{{Targets: []string{"h:1"}}}}}
+	if relabeled := Relabel(jobs, nil); !reflect.DeepEqual(relabeled, jobs) {
+		t.Errorf("expected the jobs to be unchanged, got %+v", relabeled)
+	}
+}
@@ -0,0 +1,62 @@
+package backends
+
+import (
+	"context"
+	"time"
+)
+
+// Runner runs a backend in its own goroutine until it is stopped
+type Runner struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Publisher receives the discoveries of the backends. Publish must not
+// block.
+type Publisher interface {
+	Publish(BackendData)
+}
+
+// PublisherFunc is a function used as a Publisher
+type PublisherFunc func(BackendData)
+
+// Publish calls f
+func (f PublisherFunc) Publish(data BackendData) {
+	f(data)
+}
+
+// Run polls the backend in a new goroutine and publishes its discoveries to
+// p. The backend is stopped when ctx is cancelled or when Stop is called.
+func Run(ctx context.Context, b BackendInterface, p Publisher) *Runner {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &Runner{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(r.done)
+		poll(ctx, b, p)
+	}()
+	return r
+}
+
+// Stop cancels the backend's context and waits for its goroutine to return
+func (r *Runner) Stop() {
+	r.cancel()
+	<-r.done
+}
+
+// Sleep waits for the given duration. It returns false if ctx was cancelled
+// in the meantime.
+func Sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
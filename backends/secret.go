@@ -0,0 +1,49 @@
+package backends
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var envVarRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnv replaces every ${VAR} in s with the value of the environment
+// variable VAR. An unset variable is an error.
+func ExpandEnv(s string) (string, error) {
+	var err error
+	expanded := envVarRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := envVarRe.FindStringSubmatch(m)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable `%s` is not set", name)
+		}
+		return v
+	})
+	return expanded, err
+}
+
+// Secret resolves a credential which is either written in the config file,
+// possibly with ${VAR} references, or read from a file. field is the name of
+// the setting, used in errors.
+func Secret(field, value, file string) (string, error) {
+	if value != "" && file != "" {
+		return "", fmt.Errorf("fields `%s` and `%s_file` are mutually exclusive", field, field)
+	}
+
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read `%s_file`: %s", field, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+
+	s, err := ExpandEnv(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid field `%s`: %s", field, err)
+	}
+	return s, nil
+}
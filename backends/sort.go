@@ -0,0 +1,83 @@
+package backends
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SortJobs returns a copy of the jobs sorted by job name, with their static
+// configs sorted by target, so that equal discoveries always render the
+// same way
+func SortJobs(jobs []JobConfig) []JobConfig {
+	sorted := make([]JobConfig, len(jobs))
+	for i, job := range jobs {
+		staticConfigs := make([]StaticConfig, len(job.StaticConfigs))
+		for j, sc := range job.StaticConfigs {
+			targets := append([]string(nil), sc.Targets...)
+			sort.Strings(targets)
+			staticConfigs[j] = StaticConfig{
+				Targets: targets,
+				Labels:  sc.Labels,
+			}
+		}
+		sort.SliceStable(staticConfigs, func(a, b int) bool {
+			return staticConfigKey(staticConfigs[a]) < staticConfigKey(staticConfigs[b])
+		})
+
+		job.StaticConfigs = staticConfigs
+		sorted[i] = job
+	}
+
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].JobName < sorted[b].JobName
+	})
+	return sorted
+}
+
+// staticConfigKey returns the sort key of a static config: its targets,
+// then its labels
+func staticConfigKey(sc StaticConfig) string {
+	labels := make([]string, 0, len(sc.Labels))
+	for k, v := range sc.Labels {
+		labels = append(labels, fmt.Sprintf("%s=%q", k, v))
+	}
+	sort.Strings(labels)
+	return strings.Join(sc.Targets, ",") + "\xff" + strings.Join(labels, ",")
+}
+
+// failedHash stands for a failed discovery in the change detection of the
+// poller. It never equals the Hash of any jobs, so that the next successful
+// discovery is always sent.
+const failedHash = "failed"
+
+// Hash returns the SHA-256 of the jobs, independently of their order. It
+// is used to detect changes between two discoveries.
+func Hash(jobs []JobConfig) string {
+	y, err := yaml.Marshal(SortJobs(jobs))
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(y))
+}
+
+// SortData returns the backends data sorted by backend and ID, with sorted
+// jobs
+func SortData(data map[string]BackendData) []BackendData {
+	sorted := make([]BackendData, 0, len(data))
+	for _, d := range data {
+		d.Jobs = SortJobs(d.Jobs)
+		sorted = append(sorted, d)
+	}
+
+	sort.Slice(sorted, func(a, b int) bool {
+		if sorted[a].Backend != sorted[b].Backend {
+			return sorted[a].Backend < sorted[b].Backend
+		}
+		return sorted[a].ID < sorted[b].ID
+	})
+	return sorted
+}
@@ -1,17 +1,25 @@
 package static
 
 import (
-	"reflect"
-	"time"
-
-	log "github.com/Sirupsen/logrus"
+	"context"
 
 	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/relabel"
 )
 
-// Static is a struct which stores the Static configuration parameters
+func init() {
+	backends.Register("static", func() backends.BackendInterface {
+		return &Static{}
+	})
+}
+
+// Static is a struct which stores the Static configuration parameters. Like
+// for every backend, the relabel_configs of the entry are applied to the
+// discovered targets, so the relabel_configs of the job sent to Prometheus
+// are set by job_relabel_configs.
 type Static struct {
 	backends.JobConfig `yaml:",inline"`
+	JobRelabelConfigs  []relabel.Config `yaml:"job_relabel_configs,omitempty"`
 }
 
 // New creates a new Static client
@@ -19,29 +27,19 @@ func (cfg *Static) New() (err error) {
 	return
 }
 
-// Start starts the Static service discovery
-func (cfg *Static) Start(d chan backends.BackendData) {
-	var data, w backends.BackendData
-
-	for {
-		w = backends.BackendData{
-			ID:      cfg.JobName,
-			Backend: "static",
-			Jobs: []backends.JobConfig{
-				cfg.JobConfig,
-			},
-		}
-
-		if !reflect.DeepEqual(w, data) {
-			data = w
-			d <- data
-		}
-		log.WithFields(log.Fields{
-			"backend": "static",
-			"name":    cfg.JobName,
-		}).Debugf("Sleeping for %ds", 1000)
-		time.Sleep(1000 * time.Second)
-	}
+// Schedule makes the configured job discovered once, as it only changes
+// when the configuration is reloaded
+func (cfg *Static) Schedule() backends.Schedule {
+	return backends.Schedule{Once: true}
+}
+
+// Discover returns the configured job
+func (cfg *Static) Discover(ctx context.Context) ([]backends.JobConfig, error) {
+	job := cfg.JobConfig
+	job.RelabelConfigs = cfg.JobRelabelConfigs
+	return []backends.JobConfig{
+		job,
+	}, nil
 }
 
 // GetName returns the backend's name
@@ -0,0 +1,38 @@
+package static
+
+import (
+	"context"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestDiscoverRelabelConfigs(t *testing.T) {
+	var cfg Static
+	err := yaml.Unmarshal([]byte(`
+job_name: a
+static_configs:
+  - targets: ["h:1"]
+relabel_configs:
+  - target_label: discovery
+    replacement: x
+job_relabel_configs:
+  - target_label: prometheus
+    replacement: y
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := cfg.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(jobs))
+	}
+	rc := jobs[0].RelabelConfigs
+	if len(rc) != 1 || rc[0].TargetLabel != "prometheus" {
+		t.Errorf("expected the job to get job_relabel_configs, got %+v", rc)
+	}
+}
@@ -0,0 +1,72 @@
+package backends
+
+import (
+	"sync"
+	"time"
+)
+
+// Status is the discovery state of a backend instance
+type Status struct {
+	Backend             string     `json:"backend"`
+	ID                  string     `json:"id"`
+	LastSuccess         *time.Time `json:"last_success"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorTime       *time.Time `json:"last_error_time,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Targets             int        `json:"targets"`
+}
+
+type statusKey struct {
+	name, id string
+}
+
+var (
+	statusesMu sync.RWMutex
+	statuses   = make(map[statusKey]Status)
+)
+
+// GetStatus returns the status of a backend instance. An instance which
+// never ran a discovery has an empty status.
+func GetStatus(name, id string) Status {
+	statusesMu.RLock()
+	defer statusesMu.RUnlock()
+
+	s, ok := statuses[statusKey{name, id}]
+	if !ok {
+		return Status{Backend: name, ID: id}
+	}
+	return s
+}
+
+func recordSuccess(name, id string, targets int) {
+	statusesMu.Lock()
+	defer statusesMu.Unlock()
+
+	now := time.Now()
+	s := statuses[statusKey{name, id}]
+	s.Backend, s.ID = name, id
+	s.LastSuccess = &now
+	s.ConsecutiveFailures = 0
+	s.Targets = targets
+	statuses[statusKey{name, id}] = s
+}
+
+func recordFailure(name, id string, err error) {
+	statusesMu.Lock()
+	defer statusesMu.Unlock()
+
+	now := time.Now()
+	s := statuses[statusKey{name, id}]
+	s.Backend, s.ID = name, id
+	s.LastError = err.Error()
+	s.LastErrorTime = &now
+	s.ConsecutiveFailures++
+	statuses[statusKey{name, id}] = s
+}
+
+func forgetStatus(name, id string) {
+	statusesMu.Lock()
+	defer statusesMu.Unlock()
+
+	delete(statuses, statusKey{name, id})
+}
@@ -0,0 +1,96 @@
+package backends
+
+import (
+	"github.com/cryptobioz/prometheus-service-discovery/relabel"
+)
+
+// JobTemplate stores scrape settings which are merged into every job
+// generated by a backend. Each setting which is set in the template
+// overrides the one of the job.
+type JobTemplate struct {
+	ScrapeInterval       string              `yaml:"scrape_interval,omitempty"`
+	ScrapeTimeout        string              `yaml:"scrape_timeout,omitempty"`
+	MetricsPath          string              `yaml:"metrics_path,omitempty"`
+	Scheme               string              `yaml:"scheme,omitempty"`
+	HonorLabels          *bool               `yaml:"honor_labels,omitempty"`
+	Params               map[string][]string `yaml:"params,omitempty"`
+	BasicAuth            *BasicAuth          `yaml:"basic_auth,omitempty"`
+	BearerToken          string              `yaml:"bearer_token,omitempty"`
+	BearerTokenFile      string              `yaml:"bearer_token_file,omitempty"`
+	Authorization        *Authorization      `yaml:"authorization,omitempty"`
+	OAuth2               *OAuth2             `yaml:"oauth2,omitempty"`
+	TLSConfig            *TLSConfig          `yaml:"tls_config,omitempty"`
+	ProxyURL             string              `yaml:"proxy_url,omitempty"`
+	FollowRedirects      *bool               `yaml:"follow_redirects,omitempty"`
+	SampleLimit          int                 `yaml:"sample_limit,omitempty"`
+	LabelLimit           int                 `yaml:"label_limit,omitempty"`
+	RelabelConfigs       []relabel.Config    `yaml:"relabel_configs,omitempty"`
+	MetricRelabelConfigs []relabel.Config    `yaml:"metric_relabel_configs,omitempty"`
+}
+
+// Apply returns a copy of the jobs with the settings of the template
+func (t *JobTemplate) Apply(jobs []JobConfig) []JobConfig {
+	if t == nil {
+		return jobs
+	}
+
+	applied := make([]JobConfig, 0, len(jobs))
+	for _, job := range jobs {
+		if t.ScrapeInterval != "" {
+			job.ScrapeInterval = t.ScrapeInterval
+		}
+		if t.ScrapeTimeout != "" {
+			job.ScrapeTimeout = t.ScrapeTimeout
+		}
+		if t.MetricsPath != "" {
+			job.MetricsPath = t.MetricsPath
+		}
+		if t.Scheme != "" {
+			job.Scheme = t.Scheme
+		}
+		if t.HonorLabels != nil {
+			job.HonorLabels = *t.HonorLabels
+		}
+		if len(t.Params) > 0 {
+			job.Params = t.Params
+		}
+		if t.BasicAuth != nil {
+			job.BasicAuth = t.BasicAuth
+		}
+		if t.BearerToken != "" {
+			job.BearerToken = t.BearerToken
+		}
+		if t.BearerTokenFile != "" {
+			job.BearerTokenFile = t.BearerTokenFile
+		}
+		if t.Authorization != nil {
+			job.Authorization = t.Authorization
+		}
+		if t.OAuth2 != nil {
+			job.OAuth2 = t.OAuth2
+		}
+		if t.TLSConfig != nil {
+			job.TLSConfig = t.TLSConfig
+		}
+		if t.ProxyURL != "" {
+			job.ProxyURL = t.ProxyURL
+		}
+		if t.FollowRedirects != nil {
+			job.FollowRedirects = t.FollowRedirects
+		}
+		if t.SampleLimit != 0 {
+			job.SampleLimit = t.SampleLimit
+		}
+		if t.LabelLimit != 0 {
+			job.LabelLimit = t.LabelLimit
+		}
+		if len(t.RelabelConfigs) > 0 {
+			job.RelabelConfigs = t.RelabelConfigs
+		}
+		if len(t.MetricRelabelConfigs) > 0 {
+			job.MetricRelabelConfigs = t.MetricRelabelConfigs
+		}
+		applied = append(applied, job)
+	}
+	return applied
+}
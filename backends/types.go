@@ -1,15 +1,69 @@
 package backends
 
+import (
+	"context"
+
+	"github.com/cryptobioz/prometheus-service-discovery/relabel"
+)
+
 // JobConfig is a Prometheus job representation
 type JobConfig struct {
-	JobName       string                 `yaml:"job_name,omitempty"`
-	HonorLabels   bool                   `yaml:"honor_labels,omitempty"`
-	MetricsPath   string                 `yaml:"metrics_path,omitempty"`
-	Params        string                 `yaml:"params,omitempty"`
-	StaticConfigs []StaticConfig         `yaml:"static_configs,omitempty"`
-	Scheme        string                 `yaml:"scheme,omitempty"`
-	BasicAuth     map[string]string      `yaml:"basic_auth,omitempty"`
-	TLSConfig     map[string]interface{} `yaml:"tls_config,omitempty"`
+	JobName              string              `yaml:"job_name,omitempty"`
+	HonorLabels          bool                `yaml:"honor_labels,omitempty"`
+	MetricsPath          string              `yaml:"metrics_path,omitempty"`
+	Params               map[string][]string `yaml:"params,omitempty"`
+	StaticConfigs        []StaticConfig      `yaml:"static_configs,omitempty"`
+	Scheme               string              `yaml:"scheme,omitempty"`
+	BasicAuth            *BasicAuth          `yaml:"basic_auth,omitempty"`
+	TLSConfig            *TLSConfig          `yaml:"tls_config,omitempty"`
+	ScrapeInterval       string              `yaml:"scrape_interval,omitempty"`
+	ScrapeTimeout        string              `yaml:"scrape_timeout,omitempty"`
+	RelabelConfigs       []relabel.Config    `yaml:"relabel_configs,omitempty"`
+	MetricRelabelConfigs []relabel.Config    `yaml:"metric_relabel_configs,omitempty"`
+	BearerToken          string              `yaml:"bearer_token,omitempty"`
+	BearerTokenFile      string              `yaml:"bearer_token_file,omitempty"`
+	Authorization        *Authorization      `yaml:"authorization,omitempty"`
+	OAuth2               *OAuth2             `yaml:"oauth2,omitempty"`
+	ProxyURL             string              `yaml:"proxy_url,omitempty"`
+	FollowRedirects      *bool               `yaml:"follow_redirects,omitempty"`
+	SampleLimit          int                 `yaml:"sample_limit,omitempty"`
+	LabelLimit           int                 `yaml:"label_limit,omitempty"`
+}
+
+// BasicAuth is a Prometheus basic_auth representation
+type BasicAuth struct {
+	Username     string `yaml:"username,omitempty"`
+	Password     string `yaml:"password,omitempty"`
+	PasswordFile string `yaml:"password_file,omitempty"`
+}
+
+// Authorization is a Prometheus authorization representation
+type Authorization struct {
+	Type            string `yaml:"type,omitempty"`
+	Credentials     string `yaml:"credentials,omitempty"`
+	CredentialsFile string `yaml:"credentials_file,omitempty"`
+}
+
+// OAuth2 is a Prometheus oauth2 representation
+type OAuth2 struct {
+	ClientID         string            `yaml:"client_id,omitempty"`
+	ClientSecret     string            `yaml:"client_secret,omitempty"`
+	ClientSecretFile string            `yaml:"client_secret_file,omitempty"`
+	Scopes           []string          `yaml:"scopes,omitempty"`
+	TokenURL         string            `yaml:"token_url,omitempty"`
+	EndpointParams   map[string]string `yaml:"endpoint_params,omitempty"`
+	TLSConfig        *TLSConfig        `yaml:"tls_config,omitempty"`
+	ProxyURL         string            `yaml:"proxy_url,omitempty"`
+}
+
+// TLSConfig is a Prometheus tls_config representation
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+	MinVersion         string `yaml:"min_version,omitempty"`
 }
 
 // StaticConfig is a Prometheus static config representation
@@ -18,17 +72,39 @@ type StaticConfig struct {
 	Labels  map[string]string `yaml:"labels,omitempty"`
 }
 
-// BackendData is used to store backend's metadata
+// BackendData is used to store backend's metadata. Err is set when a
+// discovery failed, in which case Jobs is empty.
 type BackendData struct {
 	ID      string
 	Backend string
 	Jobs    []JobConfig
+	Err     error
 }
 
-// BackendInterface is used to abstract backends
+// BackendInterface is used to abstract backends. The discoveries are
+// scheduled by Run.
 type BackendInterface interface {
 	New() error
-	Start(chan BackendData)
+	Discover(context.Context) ([]JobConfig, error)
 	GetName() string
 	GetID() string
 }
+
+// Scheduler is implemented by backends which set how often they are
+// discovered. Other backends use DefaultSchedule.
+type Scheduler interface {
+	Schedule() Schedule
+}
+
+// Checker is implemented by backends which can validate their
+// configuration without contacting any remote service
+type Checker interface {
+	Check() error
+}
+
+// SecretHolder is implemented by backends which read credentials from the
+// environment or from files. The resolved credentials are part of the
+// fingerprint of the backend, so that a reload restarts it when they change.
+type SecretHolder interface {
+	Secrets() []string
+}
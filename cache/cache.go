@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+)
+
+// entry is the content of a cache file
+type entry struct {
+	Backend string               `yaml:"backend"`
+	ID      string               `yaml:"id"`
+	Time    time.Time            `yaml:"time"`
+	Jobs    []backends.JobConfig `yaml:"jobs"`
+}
+
+// path returns the path of the cache file of a backend instance
+func path(dir, name, id string) string {
+	return filepath.Join(dir, url.PathEscape(name)+"_"+url.PathEscape(id)+".yml")
+}
+
+// Save stores the data of a backend instance, discovered at the given time,
+// in dir
+func Save(dir string, data backends.BackendData, discovered time.Time) error {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create state directory: %s", err)
+	}
+
+	content, err := yaml.Marshal(entry{
+		Backend: data.Backend,
+		ID:      data.ID,
+		Time:    discovered,
+		Jobs:    data.Jobs,
+	})
+	if err != nil {
+		return err
+	}
+
+	p := path(dir, data.Backend, data.ID)
+	tmp, err := ioutil.TempFile(dir, filepath.Base(p)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Load returns the data of a backend instance stored in dir and the time
+// it was discovered, if it is not older than maxAge
+func Load(dir, name, id string, maxAge time.Duration) (data backends.BackendData, discovered time.Time, ok bool, err error) {
+	content, err := ioutil.ReadFile(path(dir, name, id))
+	if os.IsNotExist(err) {
+		return data, discovered, false, nil
+	}
+	if err != nil {
+		return
+	}
+
+	var e entry
+	err = yaml.Unmarshal(content, &e)
+	if err != nil {
+		return data, discovered, false, fmt.Errorf("invalid cache file: %s", err)
+	}
+	if e.Backend != name || e.ID != id {
+		return data, discovered, false, fmt.Errorf("cache file belongs to %s backend `%s`", e.Backend, e.ID)
+	}
+	if time.Since(e.Time) > maxAge {
+		return data, discovered, false, nil
+	}
+
+	return backends.BackendData{
+		ID:      e.ID,
+		Backend: e.Backend,
+		Jobs:    e.Jobs,
+	}, e.Time, true, nil
+}
+
+// Remove deletes the data of a backend instance stored in dir
+func Remove(dir, name, id string) error {
+	err := os.Remove(path(dir, name, id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
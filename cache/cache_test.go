@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+)
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "psd-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := backends.BackendData{
+		Backend: "static",
+		ID:      "a/b",
+		Jobs:    []backends.JobConfig{{JobName: "a"}},
+	}
+	discovered := time.Now().Add(-30 * time.Second).Round(time.Second)
+	err = Save(dir, data, discovered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, at, ok, err := Load(dir, "static", "a/b", time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("expected cached data, got ok=%v err=%v", ok, err)
+	}
+	if !at.Equal(discovered) {
+		t.Errorf("expected discovery time %s, got %s", discovered, at)
+	}
+	if len(loaded.Jobs) != 1 || loaded.Jobs[0].JobName != "a" {
+		t.Errorf("unexpected jobs %+v", loaded.Jobs)
+	}
+
+	// The age is measured from the discovery
+	_, _, ok, err = Load(dir, "static", "a/b", 10*time.Second)
+	if err != nil || ok {
+		t.Errorf("expected data older than the maximum age to be ignored, got ok=%v err=%v", ok, err)
+	}
+
+	err = Remove(dir, "static", "a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, ok, _ = Load(dir, "static", "a/b", time.Minute)
+	if ok {
+		t.Error("expected removed data to be missing")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+)
+
+// check validates the configuration file without contacting the backends
+func check(configFile string) int {
+	y, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read config: %s\n", err)
+		return 1
+	}
+
+	_, err = config.LoadConfig(y)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config: %s\n", err)
+		return 1
+	}
+
+	instances, err := config.LoadBackends(y)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("%s is valid (%d backends)\n", configFile, len(instances))
+	return 0
+}
+
+// once runs every backend a single time and writes the output. It returns
+// a non-zero exit code if any backend failed.
+func once(configFile string, timeout time.Duration) int {
+	y, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		log.Errorf("failed to read config: %s", err)
+		return 1
+	}
+
+	log.SetLevel(log.DebugLevel)
+
+	cfg, err := config.LoadConfig(y)
+	if err != nil {
+		log.Errorf("failed to load config: %s", err)
+		return 1
+	}
+
+	instances, err := config.LoadBackends(y)
+	if err != nil {
+		log.Errorf("failed to load config: %s", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-term:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	d := newDaemon(ctx, configFile)
+	d.cfg = cfg
+	d.setInstances(instances)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+	)
+	for _, inst := range instances {
+		wg.Add(1)
+		go func(inst config.Backend) {
+			defer wg.Done()
+
+			back := inst.Backend
+			jobs, err := discoverOnce(ctx, back)
+			if err == nil {
+				d.publisher(inst).Publish(backends.BackendData{
+					ID:      back.GetID(),
+					Backend: back.GetName(),
+					Jobs:    jobs,
+				})
+				// The publisher may handle the discovery as a failure
+				if s, ok := d.agg.Get(inst.Key); ok {
+					err = s.Err
+				}
+			}
+			if err != nil {
+				log.WithFields(log.Fields{
+					"backend": back.GetName(),
+					"id":      back.GetID(),
+				}).Errorf("failed to discover targets: %s", err)
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}(inst)
+	}
+	wg.Wait()
+
+	d.refresh()
+	err = d.writer.write(ctx)
+	if err != nil {
+		return 1
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func discoverOnce(ctx context.Context, back backends.BackendInterface) ([]backends.JobConfig, error) {
+	err := back.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize backend: %s", err)
+	}
+	return backends.Discover(ctx, back, 0)
+}
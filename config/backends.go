@@ -0,0 +1,179 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/relabel"
+)
+
+// Backends stores backends configurations
+type Backends struct {
+	Backends map[string][]interface{} `yaml:"backends,omitempty"`
+}
+
+// Backend is a backend entry of the configuration file. Fingerprint
+// identifies the entry and the secrets it resolved, so that a changed
+// secret is detected on reload even if the entry itself did not change.
+type Backend struct {
+	Key         string
+	Fingerprint string
+	Backend     backends.BackendInterface
+	Common
+}
+
+// Common stores the settings which every backend entry accepts, on top of
+// the backend's own settings
+type Common struct {
+	RelabelConfigs  []relabel.Config      `yaml:"relabel_configs,omitempty"`
+	Labels          map[string]string     `yaml:"labels,omitempty"`
+	LabelPrecedence string                `yaml:"label_precedence,omitempty"`
+	JobTemplate     *backends.JobTemplate `yaml:"job_template,omitempty"`
+	Stale           Stale                 `yaml:"stale,omitempty"`
+}
+
+// Stale policies
+const (
+	StalePolicyKeep = "keep"
+	StalePolicyDrop = "drop"
+)
+
+// Stale stores how the targets of the last successful discovery are served
+// while a backend fails: they are kept for TTL seconds, then kept or dropped
+// according to Policy. If EmptyIsFailure is set, a discovery which returns
+// no target is handled as a failure.
+type Stale struct {
+	TTL            time.Duration `yaml:"ttl,omitempty"`
+	Policy         string        `yaml:"policy,omitempty"`
+	EmptyIsFailure bool          `yaml:"empty_is_failure,omitempty"`
+}
+
+func (s *Stale) setup() error {
+	if s.TTL == 0 {
+		s.TTL = 300
+	}
+
+	if s.Policy == "" {
+		s.Policy = StalePolicyKeep
+	}
+	if s.Policy != StalePolicyKeep && s.Policy != StalePolicyDrop {
+		return fmt.Errorf("invalid stale policy `%s` (must be `%s` or `%s`)", s.Policy, StalePolicyKeep, StalePolicyDrop)
+	}
+	return nil
+}
+
+// InjectedLabels returns the labels to inject in the targets of the backend: the
+// global labels overridden by the backend's own, and whether they take
+// precedence over the discovered labels
+func (b Backend) InjectedLabels(cfg Config) (labels map[string]string, override bool) {
+	labels = make(map[string]string, len(cfg.Config.Labels)+len(b.Labels))
+	for k, v := range cfg.Config.Labels {
+		labels[k] = v
+	}
+	for k, v := range b.Labels {
+		labels[k] = v
+	}
+
+	precedence := b.LabelPrecedence
+	if precedence == "" {
+		precedence = cfg.Config.LabelPrecedence
+	}
+	return labels, precedence == PrecedenceConfigured
+}
+
+// BackendKey returns the key identifying a backend instance
+func BackendKey(name, id string) string {
+	return fmt.Sprintf("%s_%s", name, id)
+}
+
+// LoadBackends instantiates every backend entry of the config file using
+// the registered backend factories
+func LoadBackends(y []byte) (instances []Backend, err error) {
+	var b Backends
+	err = yaml.Unmarshal(y, &b)
+	if err != nil {
+		return
+	}
+	if reflect.DeepEqual(b, (Backends{})) {
+		return nil, fmt.Errorf("no backend provided")
+	}
+
+	seen := make(map[string]bool)
+	for k, v := range b.Backends {
+		factory, ok := backends.Lookup(k)
+		if !ok {
+			return nil, fmt.Errorf("unknown backend type `%s` (available: %s)", k, strings.Join(backends.Names(), ", "))
+		}
+
+		for _, target := range v {
+			back := factory()
+
+			rawTarget, err := yaml.Marshal(target)
+			if err != nil {
+				return nil, err
+			}
+			err = yaml.Unmarshal(rawTarget, back)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s backend: %s", k, err)
+			}
+
+			var common Common
+			err = yaml.Unmarshal(rawTarget, &common)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s backend: %s", k, err)
+			}
+
+			if common.LabelPrecedence != "" {
+				err = checkPrecedence(common.LabelPrecedence)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s backend `%s`: %s", k, back.GetID(), err)
+				}
+			}
+
+			err = common.Stale.setup()
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s backend `%s`: %s", k, back.GetID(), err)
+			}
+
+			if c, ok := back.(backends.Checker); ok {
+				err = c.Check()
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s backend `%s`: %s", k, back.GetID(), err)
+				}
+			}
+
+			key := BackendKey(back.GetName(), back.GetID())
+			if seen[key] {
+				return nil, fmt.Errorf("duplicate %s backend `%s`", back.GetName(), back.GetID())
+			}
+			seen[key] = true
+
+			instances = append(instances, Backend{
+				Key:         key,
+				Fingerprint: fingerprint(rawTarget, back),
+				Backend:     back,
+				Common:      common,
+			})
+		}
+	}
+	return
+}
+
+func fingerprint(raw []byte, back backends.BackendInterface) string {
+	h := sha256.New()
+	h.Write(raw)
+	if s, ok := back.(backends.SecretHolder); ok {
+		for _, secret := range s.Secrets() {
+			h.Write([]byte{0})
+			h.Write([]byte(secret))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -1,17 +1,110 @@
 package config
 
 import (
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
 	"gopkg.in/yaml.v2"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/relabel"
 )
 
+// Output formats
+const (
+	FormatScrapeConfigs = "scrape_configs"
+	FormatFileSDJSON    = "file_sd_json"
+	FormatFileSDYAML    = "file_sd_yaml"
+	FormatPrometheus    = "prometheus_config"
+)
+
+// Label precedences, deciding which value wins when a discovered target
+// already has one of the configured labels
+const (
+	PrecedenceDiscovered = "discovered"
+	PrecedenceConfigured = "configured"
+)
+
+// DefaultTemplateMarker is the job name marking where discovered jobs are
+// inserted in a prometheus_config template
+const DefaultTemplateMarker = "__discovered__"
+
+// Output stores an output configuration
+type Output struct {
+	Type   string `yaml:"type,omitempty"`
+	Path   string `yaml:"path,omitempty"`
+	Format string `yaml:"format,omitempty"`
+	Reload Reload `yaml:"reload,omitempty"`
+
+	// Mode, Owner, Group and Backups are used by the file type
+	Mode    os.FileMode `yaml:"mode,omitempty"`
+	Owner   string      `yaml:"owner,omitempty"`
+	Group   string      `yaml:"group,omitempty"`
+	Backups int         `yaml:"backups,omitempty"`
+
+	// Template and TemplateMarker are used by the prometheus_config format
+	Template       string `yaml:"template,omitempty"`
+	TemplateMarker string `yaml:"template_marker,omitempty"`
+}
+
+// Reload stores the Prometheus servers to reload after an output was
+// written
+type Reload struct {
+	URLs          []string      `yaml:"urls,omitempty"`
+	Retries       int           `yaml:"retries,omitempty"`
+	RetryInterval time.Duration `yaml:"retry_interval,omitempty"`
+	Timeout       time.Duration `yaml:"timeout,omitempty"`
+	BasicAuth     struct {
+		Username     string `yaml:"username,omitempty"`
+		Password     string `yaml:"password,omitempty"`
+		PasswordFile string `yaml:"password_file,omitempty"`
+	} `yaml:"basic_auth,omitempty"`
+}
+
+// Outputs is a list of outputs. It can be written in the config file either
+// as a single output or as a list of outputs.
+type Outputs []Output
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (o *Outputs) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []Output
+	err := unmarshal(&list)
+	if err == nil {
+		*o = list
+		return nil
+	}
+
+	var single Output
+	err = unmarshal(&single)
+	if err != nil {
+		return err
+	}
+	*o = Outputs{single}
+	return nil
+}
+
 // Config stores main configuration options
 type Config struct {
 	Config struct {
-		Output struct {
-			Type string `yaml:"type,omitempty"`
-			Path string `yaml:"path,omitempty"`
-		} `yaml:"output,omitempty"`
-		LogLevel string `yaml:"log_level,omitempty"`
+		Output          Outputs           `yaml:"output,omitempty"`
+		LogLevel        string            `yaml:"log_level,omitempty"`
+		WatchInterval   time.Duration     `yaml:"watch_interval,omitempty"`
+		RelabelConfigs  []relabel.Config  `yaml:"relabel_configs,omitempty"`
+		Labels          map[string]string `yaml:"labels,omitempty"`
+		LabelPrecedence string            `yaml:"label_precedence,omitempty"`
+		StateDir        string            `yaml:"state_dir,omitempty"`
+		CacheMaxAge     time.Duration     `yaml:"cache_max_age,omitempty"`
+		Write           struct {
+			Debounce    time.Duration `yaml:"debounce,omitempty"`
+			MinInterval time.Duration `yaml:"min_interval,omitempty"`
+			MaxDelay    time.Duration `yaml:"max_delay,omitempty"`
+		} `yaml:"write,omitempty"`
+		Web struct {
+			ListenAddress   string        `yaml:"listen_address,omitempty"`
+			StartupDeadline time.Duration `yaml:"startup_deadline,omitempty"`
+		} `yaml:"web,omitempty"`
 	} `yaml:"config,omitempty"`
 }
 
@@ -22,8 +115,137 @@ func LoadConfig(y []byte) (conf Config, err error) {
 		return
 	}
 
-	if conf.Config.Output.Type == "" {
-		conf.Config.Output.Type = "stdout"
+	if len(conf.Config.Output) == 0 {
+		conf.Config.Output = Outputs{Output{}}
+	}
+
+	for i := range conf.Config.Output {
+		err = conf.Config.Output[i].setup()
+		if err != nil {
+			return conf, fmt.Errorf("invalid output #%d: %s", i, err)
+		}
+	}
+
+	if conf.Config.LabelPrecedence == "" {
+		conf.Config.LabelPrecedence = PrecedenceDiscovered
+	}
+	err = checkPrecedence(conf.Config.LabelPrecedence)
+	if err != nil {
+		return
+	}
+
+	if conf.Config.WatchInterval == 0 {
+		conf.Config.WatchInterval = 5
+	}
+	if conf.Config.WatchInterval < 0 {
+		return conf, fmt.Errorf("field `watch_interval` must be positive")
+	}
+
+	if conf.Config.Write.Debounce == 0 {
+		conf.Config.Write.Debounce = 1
+	}
+	if conf.Config.Write.MaxDelay == 0 {
+		conf.Config.Write.MaxDelay = 10
+	}
+	if conf.Config.Write.Debounce < 0 || conf.Config.Write.MinInterval < 0 || conf.Config.Write.MaxDelay < 0 {
+		return conf, fmt.Errorf("write settings must be positive")
+	}
+
+	if conf.Config.CacheMaxAge == 0 {
+		conf.Config.CacheMaxAge = 3600
+	}
+
+	if conf.Config.Web.StartupDeadline == 0 {
+		conf.Config.Web.StartupDeadline = 60
 	}
 	return
 }
+
+func (o *Output) setup() error {
+	if o.Type == "" {
+		o.Type = "stdout"
+	}
+
+	if o.Format == "" {
+		o.Format = FormatScrapeConfigs
+	}
+
+	if o.Mode == 0 {
+		o.Mode = 0644
+	}
+
+	if o.Backups < 0 {
+		return fmt.Errorf("field `backups` must be positive")
+	}
+
+	switch o.Type {
+	case "stdout":
+	case "file":
+		if o.Path == "" {
+			return fmt.Errorf("field `path` is required")
+		}
+	default:
+		return fmt.Errorf("unknown output type `%s`", o.Type)
+	}
+
+	switch o.Format {
+	case FormatScrapeConfigs, FormatFileSDJSON, FormatFileSDYAML:
+	case FormatPrometheus:
+		if o.Template == "" {
+			return fmt.Errorf("field `template` is required by the `%s` format", o.Format)
+		}
+		if o.TemplateMarker == "" {
+			o.TemplateMarker = DefaultTemplateMarker
+		}
+	default:
+		return fmt.Errorf("unknown output format `%s`", o.Format)
+	}
+
+	if len(o.Reload.URLs) > 0 {
+		if o.Type != "file" {
+			return fmt.Errorf("field `reload` requires a `file` output")
+		}
+		for _, u := range o.Reload.URLs {
+			parsed, err := url.Parse(u)
+			if err != nil {
+				return fmt.Errorf("invalid reload URL `%s`: %s", u, err)
+			}
+			if parsed.Scheme != "http" && parsed.Scheme != "https" {
+				return fmt.Errorf("invalid reload URL `%s`: %s is not a valid http scheme", u, parsed.Scheme)
+			}
+		}
+	}
+
+	username, err := backends.Secret("username", o.Reload.BasicAuth.Username, "")
+	if err != nil {
+		return fmt.Errorf("invalid reload basic_auth: %s", err)
+	}
+	password, err := backends.Secret("password", o.Reload.BasicAuth.Password, o.Reload.BasicAuth.PasswordFile)
+	if err != nil {
+		return fmt.Errorf("invalid reload basic_auth: %s", err)
+	}
+	o.Reload.BasicAuth.Username = username
+	o.Reload.BasicAuth.Password = password
+
+	if o.Reload.Retries == 0 {
+		o.Reload.Retries = 3
+	}
+
+	if o.Reload.RetryInterval == 0 {
+		o.Reload.RetryInterval = 2
+	}
+
+	if o.Reload.Timeout == 0 {
+		o.Reload.Timeout = 10
+	}
+	return nil
+}
+
+func checkPrecedence(p string) error {
+	switch p {
+	case PrecedenceDiscovered, PrecedenceConfigured:
+		return nil
+	default:
+		return fmt.Errorf("invalid label_precedence `%s`, must be `%s` or `%s`", p, PrecedenceDiscovered, PrecedenceConfigured)
+	}
+}
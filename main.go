@@ -1,128 +1,126 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
-	"reflect"
-	"strings"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
-	"gopkg.in/yaml.v2"
 
 	"github.com/cryptobioz/prometheus-service-discovery/backends"
-	"github.com/cryptobioz/prometheus-service-discovery/backends/cattle"
-	"github.com/cryptobioz/prometheus-service-discovery/backends/puppetdb"
-	"github.com/cryptobioz/prometheus-service-discovery/backends/static"
-	"github.com/cryptobioz/prometheus-service-discovery/config"
+	_ "github.com/cryptobioz/prometheus-service-discovery/backends/cattle"
+	_ "github.com/cryptobioz/prometheus-service-discovery/backends/puppetdb"
+	_ "github.com/cryptobioz/prometheus-service-discovery/backends/static"
 )
 
-// Backends stores backends configurations
-type Backends struct {
-	Backends map[string][]interface{} `yaml:"backends,omitempty"`
+const defaultConfigFile = "prometheus-service-discovery.yml"
+
+var version = "unknown"
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [options] [command]\n\n", os.Args[0])
+	fmt.Fprintf(out, "Commands:\n")
+	fmt.Fprintf(out, "  run      run the service discovery (default)\n")
+	fmt.Fprintf(out, "  once     run every backend once, write the output and exit\n")
+	fmt.Fprintf(out, "  check    validate the configuration file and exit\n")
+	fmt.Fprintf(out, "  version  print the version and exit\n")
+	fmt.Fprintf(out, "\nOptions:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nAvailable backends:\n")
+	for _, name := range backends.Names() {
+		fmt.Fprintf(out, "  %s\n", name)
+	}
 }
 
 func main() {
-	y, err := ioutil.ReadFile("prometheus-service-discovery.yml")
-	if err != nil {
-		return
+	configFile := flag.String("config.file", defaultConfigFile, "Path to the configuration file")
+	onceTimeout := flag.Duration("once.timeout", time.Minute, "Maximum duration of the once command")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() > 1 {
+		usage()
+		os.Exit(2)
 	}
 
-	// TODO: Add support for live reload
-	cfg, err := config.LoadConfig(y)
+	switch cmd := flag.Arg(0); cmd {
+	case "", "run":
+		run(*configFile)
+	case "once":
+		os.Exit(once(*configFile, *onceTimeout))
+	case "check":
+		os.Exit(check(*configFile))
+	case "version":
+		fmt.Printf("prometheus-service-discovery %s\n", version)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command `%s`\n\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+}
+
+func run(configFile string) {
+	y, err := ioutil.ReadFile(configFile)
 	if err != nil {
-		log.Fatalf("Failed to load config: %s", err)
+		log.Fatalf("Failed to read config: %s", err)
 	}
 
 	log.SetLevel(log.DebugLevel)
+	buildInfo.Set(1, version, runtime.Version())
+	writesCoalesced.Add(0)
 
-	var b Backends
-	err = yaml.Unmarshal(y, &b)
+	d := newDaemon(context.Background(), configFile)
+	err = d.load(y)
 	if err != nil {
-		return
-	}
-	if reflect.DeepEqual(b, (Backends{})) {
-		log.Fatalf("no backend provided")
-		return
+		log.Fatalf("Failed to load config: %s", err)
 	}
 
-	chanData := make(chan backends.BackendData)
-	var back backends.BackendInterface
-
-	// TODO: optimize
-	for k, v := range b.Backends {
-		for _, target := range v {
-			switch k {
-			case "puppetdb":
-				c := &puppetdb.PuppetDB{}
-				rawTarget, _ := yaml.Marshal(target)
-				err = yaml.Unmarshal(rawTarget, &c)
-				back = c
-			case "cattle":
-				c := &cattle.Cattle{}
-				rawTarget, _ := yaml.Marshal(target)
-				err = yaml.Unmarshal(rawTarget, &c)
-				back = c
-			case "static":
-				c := &static.Static{}
-				rawTarget, _ := yaml.Marshal(target)
-				err = yaml.Unmarshal(rawTarget, &c)
-				back = c
-			}
+	d.restore()
+	d.startWriter()
 
-			log.WithFields(log.Fields{
-				"backend": back.GetName(),
-				"id":      back.GetID(),
-			}).Info("Initializing backend...")
-			err = back.New()
+	d.web.SetStartupDeadline(time.Now().Add(d.cfg.Config.Web.StartupDeadline * time.Second))
+	if addr := d.cfg.Config.Web.ListenAddress; addr != "" {
+		go func() {
+			err := d.web.ListenAndServe(addr)
 			if err != nil {
-				log.WithFields(log.Fields{
-					"backend": back.GetName(),
-					"id":      back.GetID(),
-				}).Errorf("failed to initialize backend: %s", err)
+				log.Fatalf("Failed to start web server: %s", err)
 			}
-
-			go back.Start(chanData)
-		}
+		}()
 	}
 
-	e := make(map[string][]byte)
-	var d backends.BackendData
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGINT, syscall.SIGTERM)
+
+	changed := make(chan struct{}, 1)
+	go watchConfig(configFile, d.configWatchInterval, d.watchReset, changed)
+
 	for {
 		select {
-		case d = <-chanData:
-			i := d
-			e[fmt.Sprintf("%s_%s", i.Backend, i.ID)], err = yaml.Marshal(&d.Jobs)
-			if err != nil {
-				log.WithFields(log.Fields{
-					"backend": i.Backend,
-					"id":      i.ID,
-				}).Errorf("failed to export targets: %s", err)
-			}
-		}
-		err = writeConfig(cfg, e)
-		if err != nil {
-			log.Errorf("failed to write config file: %s", err)
-		}
-	}
-}
-
-func writeConfig(cfg config.Config, e map[string][]byte) (err error) {
-	var output []string
-	for _, v := range e {
-		output = append(output, string(v))
-	}
-	switch cfg.Config.Output.Type {
-	case "stdout":
-		log.Debugf("%s", strings.Join(output, "\n"))
-	case "file":
-		os.MkdirAll(filepath.Dir(cfg.Config.Output.Path), 0755)
-		err = ioutil.WriteFile(cfg.Config.Output.Path, []byte(strings.Join(output, "\n")), 0644)
-		if err != nil {
-			log.Errorf("failed to write output: %s", err)
+		case <-d.updates:
+			d.refresh()
+		case <-d.staleExpiry():
+			log.Info("Dropping expired stale targets...")
+			d.refresh()
+		case <-hup:
+			log.Info("Received SIGHUP, reloading configuration...")
+			d.reload()
+		case <-changed:
+			log.Info("Configuration file changed, reloading configuration...")
+			d.reload()
+		case <-term:
+			log.Info("Shutting down...")
+			d.shutdown()
 			return
 		}
 	}
-	return
 }
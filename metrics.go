@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/cryptobioz/prometheus-service-discovery/metrics"
+)
+
+var (
+	configReloadSuccessful = metrics.NewGaugeVec(
+		"psd_config_last_reload_successful",
+		"Whether the last configuration reload attempt was successful.",
+	)
+	configReloadTimestamp = metrics.NewGaugeVec(
+		"psd_config_last_reload_success_timestamp_seconds",
+		"Timestamp of the last successful configuration reload.",
+	)
+	staleTargets = metrics.NewGaugeVec(
+		"psd_backend_stale_targets",
+		"Number of targets of a failing backend served from its last successful discovery.",
+		"backend", "id",
+	)
+	writesCoalesced = metrics.NewCounterVec(
+		"psd_output_coalesced_updates_total",
+		"Number of updates merged into an already pending write.",
+	)
+	buildInfo = metrics.NewGaugeVec(
+		"psd_build_info",
+		"A metric with a constant '1' value labeled by version and goversion.",
+		"version", "goversion",
+	)
+)
@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types
+const (
+	counter   = "counter"
+	gauge     = "gauge"
+	histogram = "histogram"
+)
+
+// DefBuckets are the default histogram buckets, in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+var (
+	registryMu sync.Mutex
+	registry   []*Vec
+)
+
+// Vec is a metric family partitioned by label values
+type Vec struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	count       uint64
+}
+
+// NewCounterVec creates and registers a counter
+func NewCounterVec(name, help string, labels ...string) *Vec {
+	return register(&Vec{name: name, help: help, typ: counter, labels: labels})
+}
+
+// NewGaugeVec creates and registers a gauge
+func NewGaugeVec(name, help string, labels ...string) *Vec {
+	return register(&Vec{name: name, help: help, typ: gauge, labels: labels})
+}
+
+// NewHistogramVec creates and registers a histogram with the given buckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *Vec {
+	return register(&Vec{name: name, help: help, typ: histogram, labels: labels, buckets: buckets})
+}
+
+func register(v *Vec) *Vec {
+	v.series = make(map[string]*series)
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, r := range registry {
+		if r.name == v.name {
+			panic(fmt.Sprintf("metric `%s` is already registered", v.name))
+		}
+	}
+	registry = append(registry, v)
+	return v
+}
+
+// get returns the series for the given label values, creating it if needed.
+// v.mu must be held.
+func (v *Vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric `%s` expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(v.buckets)),
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+// Inc increments a counter or a gauge by 1
+func (v *Vec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+// Add adds the given value to a counter or a gauge
+func (v *Vec) Add(value float64, labelValues ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.get(labelValues).value += value
+}
+
+// Set sets a gauge to the given value
+func (v *Vec) Set(value float64, labelValues ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.get(labelValues).value = value
+}
+
+// Observe adds an observation to a histogram
+func (v *Vec) Observe(value float64, labelValues ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s := v.get(labelValues)
+	for i, upper := range v.buckets {
+		if value <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+// Delete removes the series with the given label values
+func (v *Vec) Delete(labelValues ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.series, strings.Join(labelValues, "\xff"))
+}
+
+// write writes the metric family in the Prometheus text format
+func (v *Vec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escape(v.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := v.series[key]
+		if v.typ != histogram {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelString(s.labelValues, "", ""), formatFloat(s.value))
+			continue
+		}
+
+		for i, upper := range v.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, v.labelString(s.labelValues, "le", formatFloat(upper)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, v.labelString(s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, v.labelString(s.labelValues, "", ""), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, v.labelString(s.labelValues, "", ""), s.count)
+	}
+}
+
+func (v *Vec) labelString(values []string, extraName, extraValue string) string {
+	var pairs []string
+	for i, l := range v.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", l, escape(values[i], true)))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string, quotes bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quotes {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+// Handler returns an HTTP handler exposing every registered metric
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registryMu.Lock()
+		vecs := append([]*Vec(nil), registry...)
+		registryMu.Unlock()
+
+		var buf bytes.Buffer
+		for _, v := range vecs {
+			v.write(&buf)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func output(v *Vec) string {
+	var buf bytes.Buffer
+	v.write(&buf)
+	return buf.String()
+}
+
+func TestCounter(t *testing.T) {
+	c := NewCounterVec("test_counter_total", "A counter.", "backend", "id")
+	c.Inc("static", "a")
+	c.Add(2.5, "static", "a")
+	c.Inc("puppetdb", "b")
+
+	expected := `# HELP test_counter_total A counter.
+# TYPE test_counter_total counter
+test_counter_total{backend="puppetdb",id="b"} 1
+test_counter_total{backend="static",id="a"} 3.5
+`
+	if got := output(c); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestGauge(t *testing.T) {
+	g := NewGaugeVec("test_gauge", "A gauge.")
+	g.Set(1e9)
+	g.Add(-0.5)
+
+	expected := `# HELP test_gauge A gauge.
+# TYPE test_gauge gauge
+test_gauge 9.999999995e+08
+`
+	if got := output(g); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	g.Set(math.Inf(1))
+	if got := output(g); !strings.HasSuffix(got, "test_gauge +Inf\n") {
+		t.Errorf("expected +Inf, got:\n%s", got)
+	}
+
+	g.Delete()
+	if got := output(g); strings.Contains(got, "\ntest_gauge ") {
+		t.Errorf("expected the series to be deleted, got:\n%s", got)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "A histogram.", []float64{0.1, 1, 10}, "backend")
+	h.Observe(0.05, "static")
+	h.Observe(0.1, "static")
+	h.Observe(5, "static")
+	h.Observe(20, "static")
+
+	expected := `# HELP test_duration_seconds A histogram.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{backend="static",le="0.1"} 2
+test_duration_seconds_bucket{backend="static",le="1"} 2
+test_duration_seconds_bucket{backend="static",le="10"} 3
+test_duration_seconds_bucket{backend="static",le="+Inf"} 4
+test_duration_seconds_sum{backend="static"} 25.15
+test_duration_seconds_count{backend="static"} 4
+`
+	if got := output(h); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	c := NewCounterVec("test_escape_total", "Help with a \\ backslash,\na newline and \"quotes\".", "path")
+	c.Inc("C:\\dir\n\"name\"")
+
+	expected := `# HELP test_escape_total Help with a \\ backslash,\na newline and "quotes".
+# TYPE test_escape_total counter
+test_escape_total{path="C:\\dir\n\"name\""} 1
+`
+	if got := output(c); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := NewCounterVec("test_handler_total", "A counter exposed by the handler.")
+	c.Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("unexpected content type `%s`", ct)
+	}
+	body, _ := ioutil.ReadAll(rec.Body)
+	if !strings.Contains(string(body), "# TYPE test_handler_total counter\ntest_handler_total 1\n") {
+		t.Errorf("expected the counter in the output, got:\n%s", body)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	NewGaugeVec("test_registered", "A gauge.")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering the same metric twice to panic")
+		}
+	}()
+	NewGaugeVec("test_registered", "A gauge.")
+}
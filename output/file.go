@@ -0,0 +1,188 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+)
+
+// backupTimeFormat is the timestamp format of the backup file names
+const backupTimeFormat = "20060102T150405.000000000Z"
+
+// writeFile atomically replaces the file output with content: the content
+// is written to a temporary file in the same directory, synced to disk and
+// renamed over the output, so readers never see a partial file. The
+// replaced file is kept as a backup if backups are enabled.
+func writeFile(o config.Output, content []byte, backup bool) (err error) {
+	dir := filepath.Dir(o.Path)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return
+	}
+
+	uid, gid, err := lookupOwner(o.Owner, o.Group)
+	if err != nil {
+		return
+	}
+
+	tmp, err := ioutil.TempFile(dir, fmt.Sprintf(".%s.tmp", filepath.Base(o.Path)))
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = tmp.Write(content)
+	if err != nil {
+		return
+	}
+
+	err = tmp.Chmod(o.Mode)
+	if err != nil {
+		return
+	}
+
+	if uid != -1 || gid != -1 {
+		err = tmp.Chown(uid, gid)
+		if err != nil {
+			return
+		}
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		return
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return
+	}
+
+	if backup && o.Backups > 0 {
+		err = backupFile(o)
+		if err != nil {
+			return fmt.Errorf("failed to back up %s: %s", o.Path, err)
+		}
+	}
+
+	err = os.Rename(tmp.Name(), o.Path)
+	if err != nil {
+		return
+	}
+
+	return syncDir(dir)
+}
+
+// backupFile keeps a timestamped copy of the current output and removes
+// the oldest backups
+func backupFile(o config.Output) error {
+	_, err := os.Stat(o.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	name := fmt.Sprintf("%s.%s.bak", o.Path, time.Now().UTC().Format(backupTimeFormat))
+	err = os.Link(o.Path, name)
+	if err != nil {
+		err = copyFile(o.Path, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	backups, err := filepath.Glob(fmt.Sprintf("%s.*.bak", o.Path))
+	if err != nil {
+		return err
+	}
+	sort.Strings(backups)
+	for len(backups) > o.Backups {
+		log.WithFields(log.Fields{
+			"path": backups[0],
+		}).Debug("Removing old backup")
+		err = os.Remove(backups[0])
+		if err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir syncs a directory so that a rename inside it is persisted
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// lookupOwner resolves the user and group names or IDs of a file output.
+// It returns -1 for the ones which are not set.
+func lookupOwner(owner, group string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+
+	if owner != "" {
+		uid, err = strconv.Atoi(owner)
+		if err != nil {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return -1, -1, err
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+
+	if group != "" {
+		gid, err = strconv.Atoi(group)
+		if err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return -1, -1, err
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
@@ -0,0 +1,99 @@
+package output
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+)
+
+func TestWriteFileBackups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "psd-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	o := config.Output{
+		Type:    "file",
+		Path:    filepath.Join(dir, "targets.yml"),
+		Mode:    0600,
+		Backups: 3,
+	}
+
+	for i := 0; i < o.Backups+2; i++ {
+		err = writeFile(o, []byte(fmt.Sprintf("generation %d", i)), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := ioutil.ReadFile(o.Path)
+	if err != nil || string(content) != "generation 4" {
+		t.Errorf("expected the last generation, got %q (%v)", content, err)
+	}
+
+	fi, err := os.Stat(o.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %s", fi.Mode().Perm())
+	}
+
+	backups, err := filepath.Glob(o.Path + ".*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != o.Backups {
+		t.Fatalf("expected %d backups, got %v", o.Backups, backups)
+	}
+
+	// The oldest generations are removed
+	for i, backup := range backups {
+		content, err := ioutil.ReadFile(backup)
+		if expected := fmt.Sprintf("generation %d", i+1); err != nil || string(content) != expected {
+			t.Errorf("expected %s to contain %q, got %q (%v)", backup, expected, content, err)
+		}
+	}
+}
+
+func TestWriteFileRemovesTempFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "psd-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The output is a directory, which can be neither backed up nor
+	// replaced
+	o := config.Output{
+		Type:    "file",
+		Path:    filepath.Join(dir, "targets.yml"),
+		Mode:    0644,
+		Backups: 1,
+	}
+	err = os.Mkdir(o.Path, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFile(o, []byte("content"), true)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range files {
+		if strings.Contains(fi.Name(), ".tmp") {
+			t.Errorf("expected the temporary file to be removed, found %s", fi.Name())
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/relabel"
+)
+
+// TargetGroup is a Prometheus file_sd target group
+type TargetGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// TargetGroups converts the jobs of every backend into file_sd target
+// groups. Job-level settings which can be expressed as labels are mapped to
+// their reserved label.
+func TargetGroups(data map[string]backends.BackendData) []TargetGroup {
+	groups := []TargetGroup{}
+	for _, d := range backends.SortData(data) {
+		for _, job := range d.Jobs {
+			jobLabels := jobLabels(job)
+
+			if ignored := ignoredSettings(job); len(ignored) > 0 {
+				log.WithFields(log.Fields{
+					"backend": d.Backend,
+					"id":      d.ID,
+					"job":     job.JobName,
+				}).Debugf("%s can not be expressed as file_sd labels and are ignored", strings.Join(ignored, ", "))
+			}
+
+			for _, sc := range job.StaticConfigs {
+				labels := make(map[string]string, len(jobLabels)+len(sc.Labels))
+				for k, v := range jobLabels {
+					labels[k] = v
+				}
+				for k, v := range sc.Labels {
+					labels[k] = v
+				}
+
+				groups = append(groups, TargetGroup{
+					Targets: sc.Targets,
+					Labels:  labels,
+				})
+			}
+		}
+	}
+	return groups
+}
+
+// jobLabels returns the labels representing the job's scrape settings
+func jobLabels(job backends.JobConfig) map[string]string {
+	labels := make(map[string]string)
+	if job.JobName != "" {
+		labels["job"] = job.JobName
+	}
+	if job.Scheme != "" {
+		labels["__scheme__"] = job.Scheme
+	}
+	if job.MetricsPath != "" {
+		labels["__metrics_path__"] = job.MetricsPath
+	}
+	if job.ScrapeInterval != "" {
+		labels["__scrape_interval__"] = job.ScrapeInterval
+	}
+	if job.ScrapeTimeout != "" {
+		labels["__scrape_timeout__"] = job.ScrapeTimeout
+	}
+	for k, v := range job.Params {
+		if len(v) > 0 && relabel.IsValidLabelName(k) {
+			labels["__param_"+k] = v[0]
+		}
+	}
+	return labels
+}
+
+// ignoredSettings returns the job settings which must be set in the
+// Prometheus job reading the target groups
+func ignoredSettings(job backends.JobConfig) (ignored []string) {
+	settings := []struct {
+		name string
+		set  bool
+	}{
+		{"honor_labels", job.HonorLabels},
+		{"basic_auth", job.BasicAuth != nil},
+		{"tls_config", job.TLSConfig != nil},
+		{"relabel_configs", len(job.RelabelConfigs) > 0},
+		{"metric_relabel_configs", len(job.MetricRelabelConfigs) > 0},
+		{"bearer_token", job.BearerToken != "" || job.BearerTokenFile != ""},
+		{"authorization", job.Authorization != nil},
+		{"oauth2", job.OAuth2 != nil},
+		{"proxy_url", job.ProxyURL != ""},
+		{"follow_redirects", job.FollowRedirects != nil},
+		{"sample_limit", job.SampleLimit != 0},
+		{"label_limit", job.LabelLimit != 0},
+	}
+	for _, s := range settings {
+		if s.set {
+			ignored = append(ignored, s.name)
+		}
+	}
+	for k, v := range job.Params {
+		switch {
+		case !relabel.IsValidLabelName(k):
+			ignored = append(ignored, fmt.Sprintf("param `%s`", k))
+		case len(v) > 1:
+			ignored = append(ignored, fmt.Sprintf("extra values of param `%s`", k))
+		}
+	}
+	return
+}
+
+func renderFileSDJSON(data map[string]backends.BackendData) ([]byte, error) {
+	return json.MarshalIndent(TargetGroups(data), "", "  ")
+}
+
+func renderFileSDYAML(data map[string]backends.BackendData) ([]byte, error) {
+	return yaml.Marshal(TargetGroups(data))
+}
@@ -0,0 +1,23 @@
+package output
+
+import (
+	"github.com/cryptobioz/prometheus-service-discovery/metrics"
+)
+
+var (
+	writes = metrics.NewCounterVec(
+		"psd_output_writes_total",
+		"Number of output writes.",
+		"type", "path",
+	)
+	writesSkipped = metrics.NewCounterVec(
+		"psd_output_writes_skipped_total",
+		"Number of output writes skipped because the content did not change.",
+		"type", "path",
+	)
+	writeFailures = metrics.NewCounterVec(
+		"psd_output_write_failures_total",
+		"Number of output writes which failed.",
+		"type", "path",
+	)
+)
@@ -0,0 +1,105 @@
+package output
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+)
+
+// Write renders the backends data and writes it to every output. The
+// Prometheus reloads are interrupted when ctx is cancelled.
+func Write(ctx context.Context, outputs config.Outputs, data map[string]backends.BackendData) (err error) {
+	var failed []string
+	for _, o := range outputs {
+		writeFailures.Add(0, o.Type, o.Path)
+		err = write(ctx, o, data)
+		writes.Inc(o.Type, o.Path)
+		if err != nil {
+			writeFailures.Inc(o.Type, o.Path)
+			log.WithFields(log.Fields{
+				"type": o.Type,
+				"path": o.Path,
+			}).Errorf("failed to write output: %s", err)
+			failed = append(failed, o.Type)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d outputs failed", len(failed))
+	}
+	return nil
+}
+
+func write(ctx context.Context, o config.Output, data map[string]backends.BackendData) (err error) {
+	content, err := Render(o, data)
+	if err != nil {
+		return
+	}
+
+	switch o.Type {
+	case "stdout":
+		log.Debugf("%s", content)
+	case "file":
+		logger := log.WithFields(log.Fields{
+			"path": o.Path,
+		})
+		previous, readErr := ioutil.ReadFile(o.Path)
+		if readErr == nil && sha256.Sum256(previous) == sha256.Sum256(content) {
+			if !reloadPending(o.Path) {
+				logger.Debug("Output unchanged, skipping write")
+				writesSkipped.Inc(o.Type, o.Path)
+				return
+			}
+			logger.Info("Output unchanged, retrying the pending Prometheus reload")
+		} else {
+			err = writeFile(o, content, true)
+			if err != nil || len(o.Reload.URLs) == 0 {
+				return
+			}
+		}
+
+		err = reloadPrometheus(ctx, o.Reload)
+		_, rejected := err.(rejectedError)
+		setReloadPending(o.Path, err != nil && !rejected)
+		if rejected {
+			return rollback(ctx, o, previous, readErr == nil, err)
+		}
+	}
+	return
+}
+
+// Render renders the backends data in the output's format
+func Render(o config.Output, data map[string]backends.BackendData) ([]byte, error) {
+	switch o.Format {
+	case config.FormatFileSDJSON:
+		return renderFileSDJSON(data)
+	case config.FormatFileSDYAML:
+		return renderFileSDYAML(data)
+	case config.FormatPrometheus:
+		return renderPrometheusConfig(o, data)
+	default:
+		return renderScrapeConfigs(data)
+	}
+}
+
+func renderScrapeConfigs(data map[string]backends.BackendData) ([]byte, error) {
+	var output []string
+	for _, d := range backends.SortData(data) {
+		if len(d.Jobs) == 0 {
+			continue
+		}
+		y, err := yaml.Marshal(&d.Jobs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export targets of %s backend `%s`: %s", d.Backend, d.ID, err)
+		}
+		output = append(output, string(y))
+	}
+	return []byte(strings.Join(output, "\n")), nil
+}
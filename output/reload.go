@@ -0,0 +1,215 @@
+package output
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+	"github.com/cryptobioz/prometheus-service-discovery/metrics"
+)
+
+var (
+	prometheusReloads = metrics.NewCounterVec(
+		"psd_prometheus_reloads_total",
+		"Number of Prometheus reloads triggered after writing an output.",
+		"url",
+	)
+	prometheusReloadFailures = metrics.NewCounterVec(
+		"psd_prometheus_reload_failures_total",
+		"Number of Prometheus reloads which failed or were rejected.",
+		"url",
+	)
+	rollbacks = metrics.NewCounterVec(
+		"psd_output_rollbacks_total",
+		"Number of outputs restored after Prometheus rejected them.",
+		"path",
+	)
+)
+
+// pendingReloads are the paths of the file outputs which were written but
+// whose Prometheus reload failed, so that an unchanged output is still
+// reloaded by the next write
+var (
+	pendingReloadsMu sync.Mutex
+	pendingReloads   = make(map[string]bool)
+)
+
+func reloadPending(path string) bool {
+	pendingReloadsMu.Lock()
+	defer pendingReloadsMu.Unlock()
+	return pendingReloads[path]
+}
+
+func setReloadPending(path string, pending bool) {
+	pendingReloadsMu.Lock()
+	defer pendingReloadsMu.Unlock()
+	if pending {
+		pendingReloads[path] = true
+	} else {
+		delete(pendingReloads, path)
+	}
+}
+
+// rejectedError is returned when Prometheus refused the new configuration.
+// Such errors are not retried.
+type rejectedError struct {
+	reason string
+}
+
+func (e rejectedError) Error() string {
+	return fmt.Sprintf("configuration rejected: %s", e.reason)
+}
+
+// reloadPrometheus reloads every configured Prometheus server. The retries
+// stop when ctx is cancelled.
+func reloadPrometheus(ctx context.Context, cfg config.Reload) error {
+	client := &http.Client{Timeout: cfg.Timeout * time.Second}
+
+	for _, u := range cfg.URLs {
+		u = strings.TrimRight(u, "/")
+		prometheusReloadFailures.Add(0, u)
+
+		var err error
+		for attempt := 0; attempt <= cfg.Retries; attempt++ {
+			if attempt > 0 {
+				log.WithFields(log.Fields{
+					"url": u,
+				}).Warnf("Failed to reload Prometheus, retrying in %ds: %s", cfg.RetryInterval, err)
+				if !backends.Sleep(ctx, cfg.RetryInterval*time.Second) {
+					err = fmt.Errorf("reload interrupted: %s", err)
+					break
+				}
+			}
+
+			err = reload(ctx, client, cfg, u)
+			if _, ok := err.(rejectedError); err == nil || ok {
+				break
+			}
+		}
+
+		prometheusReloads.Inc(u)
+		if err != nil {
+			prometheusReloadFailures.Inc(u)
+			if rejected, ok := err.(rejectedError); ok {
+				return rejectedError{fmt.Sprintf("%s (%s)", rejected.reason, u)}
+			}
+			return fmt.Errorf("failed to reload Prometheus at %s: %s", u, err)
+		}
+		log.WithFields(log.Fields{
+			"url": u,
+		}).Info("Prometheus reloaded")
+	}
+	return nil
+}
+
+// reload triggers a reload of a Prometheus server and checks whether the
+// configuration was loaded
+func reload(ctx context.Context, client *http.Client, cfg config.Reload, u string) error {
+	req, err := newRequest(ctx, cfg, "POST", u+"/-/reload")
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusInternalServerError:
+		// Prometheus answers 500 when the new configuration is invalid
+		return rejectedError{strings.TrimSpace(string(body))}
+	case resp.StatusCode/100 != 2:
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	ok, err := lastReloadSuccessful(ctx, client, cfg, u)
+	if err != nil {
+		return fmt.Errorf("failed to check reload status: %s", err)
+	}
+	if !ok {
+		return rejectedError{"prometheus_config_last_reload_successful is 0"}
+	}
+	return nil
+}
+
+// lastReloadSuccessful reads prometheus_config_last_reload_successful from
+// the Prometheus server's own metrics
+func lastReloadSuccessful(ctx context.Context, client *http.Client, cfg config.Reload, u string) (bool, error) {
+	req, err := newRequest(ctx, cfg, "GET", u+"/metrics")
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return false, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "prometheus_config_last_reload_successful" {
+			return fields[1] == "1", nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return false, fmt.Errorf("metric prometheus_config_last_reload_successful not found")
+}
+
+func newRequest(ctx context.Context, cfg config.Reload, method, u string) (*http.Request, error) {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if cfg.BasicAuth.Username != "" {
+		req.SetBasicAuth(cfg.BasicAuth.Username, cfg.BasicAuth.Password)
+	}
+	return req, nil
+}
+
+// rollback restores the previous content of a file output after Prometheus
+// rejected the new one, and reloads Prometheus with it
+func rollback(ctx context.Context, o config.Output, previous []byte, existed bool, reason error) error {
+	logger := log.WithFields(log.Fields{
+		"path": o.Path,
+	})
+	logger.Errorf("Restoring previous output: %s", reason)
+	rollbacks.Inc(o.Path)
+
+	var err error
+	if existed {
+		err = writeFile(o, previous, false)
+	} else {
+		err = os.Remove(o.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s, and failed to restore previous output: %s", reason, err)
+	}
+
+	err = reloadPrometheus(ctx, o.Reload)
+	if err != nil {
+		logger.Errorf("failed to reload Prometheus with the previous output: %s", err)
+	}
+	return reason
+}
@@ -0,0 +1,214 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+)
+
+// fakePrometheus answers the reloads with the given status codes, then
+// with the last one, and exposes the given reload result in its metrics
+type fakePrometheus struct {
+	mu       sync.Mutex
+	statuses []int
+	success  string
+	reloads  int
+}
+
+func (p *fakePrometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/-/reload":
+		status := p.statuses[0]
+		if len(p.statuses) > 1 {
+			p.statuses = p.statuses[1:]
+		}
+		p.reloads++
+		w.WriteHeader(status)
+	case "/metrics":
+		fmt.Fprintf(w, "# TYPE prometheus_config_last_reload_successful gauge\nprometheus_config_last_reload_successful %s\n", p.success)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *fakePrometheus) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.reloads
+}
+
+func testOutput(t *testing.T, u string) (config.Output, func()) {
+	dir, err := ioutil.TempDir("", "psd-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := config.Output{
+		Type: "file",
+		Path: filepath.Join(dir, "targets.yml"),
+		Mode: 0644,
+	}
+	o.Reload.URLs = []string{u}
+	return o, func() { os.RemoveAll(dir) }
+}
+
+func testData(target string) map[string]backends.BackendData {
+	return map[string]backends.BackendData{
+		"static_a": {Backend: "static", ID: "a", Jobs: []backends.JobConfig{{
+			JobName:       "a",
+			StaticConfigs: []backends.StaticConfig{{Targets: []string{target}}},
+		}}},
+	}
+}
+
+func TestWriteRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		success  string
+		previous bool
+	}{
+		{"reload failed", http.StatusInternalServerError, "1", true},
+		{"reload not successful", http.StatusOK, "0", true},
+		{"reload failed without previous output", http.StatusInternalServerError, "1", false},
+	}
+
+	for _, test := range tests {
+		p := &fakePrometheus{statuses: []int{test.status}, success: test.success}
+		srv := httptest.NewServer(p)
+		o, cleanup := testOutput(t, srv.URL)
+
+		previous := []byte("previous")
+		if test.previous {
+			ioutil.WriteFile(o.Path, previous, 0644)
+		}
+
+		err := Write(context.Background(), config.Outputs{o}, testData("h:1"))
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+
+		content, err := ioutil.ReadFile(o.Path)
+		switch {
+		case test.previous && string(content) != string(previous):
+			t.Errorf("%s: expected the previous output to be restored, got %q (%v)", test.name, content, err)
+		case !test.previous && !os.IsNotExist(err):
+			t.Errorf("%s: expected the output to be removed, got %q (%v)", test.name, content, err)
+		}
+
+		// The restored output is reloaded
+		if n := p.count(); n != 2 {
+			t.Errorf("%s: expected 2 reloads, got %d", test.name, n)
+		}
+
+		if reloadPending(o.Path) {
+			t.Errorf("%s: expected no pending reload after a rejection", test.name)
+		}
+
+		srv.Close()
+		cleanup()
+	}
+}
+
+func TestWritePendingReload(t *testing.T) {
+	p := &fakePrometheus{statuses: []int{http.StatusServiceUnavailable, http.StatusOK}, success: "1"}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	o, cleanup := testOutput(t, srv.URL)
+	defer cleanup()
+	data := testData("h:1")
+
+	err := Write(context.Background(), config.Outputs{o}, data)
+	if err == nil {
+		t.Fatal("expected the reload to fail")
+	}
+	if !reloadPending(o.Path) {
+		t.Fatal("expected a pending reload")
+	}
+	if _, err := os.Stat(o.Path); err != nil {
+		t.Fatalf("expected the output to be kept: %s", err)
+	}
+
+	// The unchanged output is reloaded again
+	err = Write(context.Background(), config.Outputs{o}, data)
+	if err != nil {
+		t.Fatalf("expected the pending reload to succeed: %s", err)
+	}
+	if n := p.count(); n != 2 {
+		t.Errorf("expected 2 reloads, got %d", n)
+	}
+	if reloadPending(o.Path) {
+		t.Error("expected no pending reload")
+	}
+
+	// Once reloaded, an unchanged output is skipped
+	err = Write(context.Background(), config.Outputs{o}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := p.count(); n != 2 {
+		t.Errorf("expected no more reload, got %d", n)
+	}
+}
+
+func TestWriteNetworkFailure(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	u := srv.URL
+	srv.Close()
+
+	o, cleanup := testOutput(t, u)
+	defer cleanup()
+
+	err := Write(context.Background(), config.Outputs{o}, testData("h:1"))
+	if err == nil {
+		t.Fatal("expected the reload to fail")
+	}
+	if !reloadPending(o.Path) {
+		t.Error("expected a pending reload")
+	}
+	setReloadPending(o.Path, false)
+}
+
+func TestWriteInterrupted(t *testing.T) {
+	p := &fakePrometheus{statuses: []int{http.StatusServiceUnavailable}, success: "1"}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	o, cleanup := testOutput(t, srv.URL)
+	defer cleanup()
+	o.Reload.Retries = 10
+	o.Reload.RetryInterval = 60
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	err := Write(ctx, config.Outputs{o}, testData("h:1"))
+	if err == nil {
+		t.Fatal("expected the reload to be interrupted")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("expected the retries to stop, took %s", d)
+	}
+	if n := p.count(); n != 1 {
+		t.Errorf("expected a single reload, got %d", n)
+	}
+	if !reloadPending(o.Path) {
+		t.Error("expected the interrupted reload to be pending")
+	}
+	setReloadPending(o.Path, false)
+}
@@ -0,0 +1,112 @@
+package output
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+)
+
+// renderPrometheusConfig renders a complete prometheus.yml: the template is
+// kept as is, except for the scrape config whose job name is the template
+// marker, which is replaced by the discovered jobs
+func renderPrometheusConfig(o config.Output, data map[string]backends.BackendData) ([]byte, error) {
+	t, err := ioutil.ReadFile(o.Template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %s", err)
+	}
+
+	var tmpl yaml.MapSlice
+	err = yaml.Unmarshal(t, &tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %s", o.Template, err)
+	}
+
+	var discovered []backends.JobConfig
+	for _, d := range backends.SortData(data) {
+		discovered = append(discovered, d.Jobs...)
+	}
+
+	found := false
+	for i, item := range tmpl {
+		if item.Key != "scrape_configs" {
+			continue
+		}
+		found = true
+
+		tmpl[i].Value, err = insertJobs(o, item.Value, discovered)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("template %s has no `scrape_configs`", o.Template)
+	}
+
+	return yaml.Marshal(tmpl)
+}
+
+// insertJobs replaces the marker of the template's scrape configs by the
+// discovered jobs
+func insertJobs(o config.Output, value interface{}, discovered []backends.JobConfig) ([]interface{}, error) {
+	scrapeConfigs, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("`scrape_configs` of template %s is not a list", o.Template)
+	}
+
+	static := make(map[string]bool)
+	marker := -1
+	for i, sc := range scrapeConfigs {
+		name := jobName(sc)
+		if name == o.TemplateMarker {
+			if marker >= 0 {
+				return nil, fmt.Errorf("template %s contains several `%s` markers", o.Template, o.TemplateMarker)
+			}
+			marker = i
+			continue
+		}
+		static[name] = true
+	}
+	if marker < 0 {
+		return nil, fmt.Errorf("template %s has no scrape config with job_name `%s`", o.Template, o.TemplateMarker)
+	}
+
+	var collisions []string
+	for _, job := range discovered {
+		if static[job.JobName] {
+			collisions = append(collisions, job.JobName)
+		}
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return nil, fmt.Errorf("discovered jobs collide with jobs of template %s: %s", o.Template, strings.Join(collisions, ", "))
+	}
+
+	output := make([]interface{}, 0, len(scrapeConfigs)-1+len(discovered))
+	output = append(output, scrapeConfigs[:marker]...)
+	for _, job := range discovered {
+		output = append(output, job)
+	}
+	output = append(output, scrapeConfigs[marker+1:]...)
+	return output, nil
+}
+
+// jobName returns the job_name of a scrape config parsed from the template
+func jobName(sc interface{}) string {
+	m, ok := sc.(yaml.MapSlice)
+	if !ok {
+		return ""
+	}
+	for _, item := range m {
+		if item.Key == "job_name" {
+			name, _ := item.Value.(string)
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,227 @@
+package relabel
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Action is a relabeling action
+type Action string
+
+// Relabeling actions, as supported by Prometheus
+const (
+	Replace   Action = "replace"
+	Keep      Action = "keep"
+	Drop      Action = "drop"
+	HashMod   Action = "hashmod"
+	LabelMap  Action = "labelmap"
+	LabelDrop Action = "labeldrop"
+	LabelKeep Action = "labelkeep"
+)
+
+var (
+	labelNameRE = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+	// targetRE matches label names which may contain references to
+	// regular expression groups
+	targetRE = regexp.MustCompile(`^(?:(?:[a-zA-Z_]|\$(?:\{\w+\}|\w+))+\w*)+$`)
+)
+
+// IsValidLabelName reports whether name is a valid Prometheus label name
+func IsValidLabelName(name string) bool {
+	return labelNameRE.MatchString(name)
+}
+
+// Regexp is an anchored regular expression which keeps its original form
+// when marshalled
+type Regexp struct {
+	*regexp.Regexp
+	original string
+}
+
+// NewRegexp compiles an anchored regular expression
+func NewRegexp(s string) (Regexp, error) {
+	re, err := regexp.Compile("^(?:" + s + ")$")
+	return Regexp{Regexp: re, original: s}, err
+}
+
+// MustNewRegexp is like NewRegexp but panics if the expression is invalid
+func MustNewRegexp(s string) Regexp {
+	re, err := NewRegexp(s)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (re *Regexp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	err := unmarshal(&s)
+	if err != nil {
+		return err
+	}
+	r, err := NewRegexp(s)
+	if err != nil {
+		return err
+	}
+	*re = r
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (re Regexp) MarshalYAML() (interface{}, error) {
+	if re.Regexp == nil {
+		return nil, nil
+	}
+	return re.original, nil
+}
+
+// Config is a Prometheus relabel config
+type Config struct {
+	SourceLabels []string `yaml:"source_labels,flow,omitempty"`
+	Separator    string   `yaml:"separator,omitempty"`
+	Regex        Regexp   `yaml:"regex,omitempty"`
+	Modulus      uint64   `yaml:"modulus,omitempty"`
+	TargetLabel  string   `yaml:"target_label,omitempty"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+	Action       Action   `yaml:"action,omitempty"`
+}
+
+// DefaultConfig is the default relabel config, as in Prometheus
+var DefaultConfig = Config{
+	Separator:   ";",
+	Regex:       MustNewRegexp("(.*)"),
+	Replacement: "$1",
+	Action:      Replace,
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultConfig
+	type plain Config
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// Validate checks that the relabel config is consistent
+func (c *Config) Validate() error {
+	if c.Regex.Regexp == nil {
+		c.Regex = DefaultConfig.Regex
+	}
+
+	switch c.Action {
+	case Replace:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel configuration for %s action requires `target_label`", c.Action)
+		}
+		if !targetRE.MatchString(c.TargetLabel) {
+			return fmt.Errorf("`%s` is an invalid target label for %s action", c.TargetLabel, c.Action)
+		}
+	case HashMod:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel configuration for %s action requires `target_label`", c.Action)
+		}
+		if c.Modulus == 0 {
+			return fmt.Errorf("relabel configuration for %s action requires a non-zero `modulus`", c.Action)
+		}
+		if !labelNameRE.MatchString(c.TargetLabel) {
+			return fmt.Errorf("`%s` is an invalid target label for %s action", c.TargetLabel, c.Action)
+		}
+	case LabelMap:
+		if !targetRE.MatchString(c.Replacement) {
+			return fmt.Errorf("`%s` is an invalid replacement for %s action", c.Replacement, c.Action)
+		}
+	case Keep, Drop, LabelDrop, LabelKeep:
+	default:
+		return fmt.Errorf("unknown relabel action `%s`", c.Action)
+	}
+	return nil
+}
+
+// Process applies the relabel configs to a copy of the labels. It returns
+// nil if the labels were dropped.
+func Process(labels map[string]string, cfgs ...Config) map[string]string {
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+
+	for _, cfg := range cfgs {
+		out = relabel(out, cfg)
+		if out == nil {
+			return nil
+		}
+	}
+	return out
+}
+
+func relabel(labels map[string]string, cfg Config) map[string]string {
+	values := make([]string, 0, len(cfg.SourceLabels))
+	for _, name := range cfg.SourceLabels {
+		values = append(values, labels[name])
+	}
+	val := strings.Join(values, cfg.Separator)
+
+	switch cfg.Action {
+	case Drop:
+		if cfg.Regex.MatchString(val) {
+			return nil
+		}
+	case Keep:
+		if !cfg.Regex.MatchString(val) {
+			return nil
+		}
+	case Replace:
+		indexes := cfg.Regex.FindStringSubmatchIndex(val)
+		if indexes == nil {
+			break
+		}
+		target := string(cfg.Regex.ExpandString([]byte{}, cfg.TargetLabel, val, indexes))
+		if !labelNameRE.MatchString(target) {
+			break
+		}
+		res := cfg.Regex.ExpandString([]byte{}, cfg.Replacement, val, indexes)
+		if len(res) == 0 {
+			delete(labels, target)
+			break
+		}
+		labels[target] = string(res)
+	case HashMod:
+		sum := md5.Sum([]byte(val))
+		mod := binary.BigEndian.Uint64(sum[8:]) % cfg.Modulus
+		labels[cfg.TargetLabel] = fmt.Sprintf("%d", mod)
+	case LabelMap:
+		for name, value := range copyLabels(labels) {
+			if cfg.Regex.MatchString(name) {
+				labels[cfg.Regex.ReplaceAllString(name, cfg.Replacement)] = value
+			}
+		}
+	case LabelDrop:
+		for name := range copyLabels(labels) {
+			if cfg.Regex.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	case LabelKeep:
+		for name := range copyLabels(labels) {
+			if !cfg.Regex.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	}
+	return labels
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,233 @@
+package relabel
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func parse(t *testing.T, y string) []Config {
+	var cfgs []Config
+	err := yaml.Unmarshal([]byte(y), &cfgs)
+	if err != nil {
+		t.Fatalf("failed to parse relabel configs: %s", err)
+	}
+	return cfgs
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfgs     string
+		labels   map[string]string
+		expected map[string]string
+	}{
+		{
+			name: "replace",
+			cfgs: `
+- source_labels: [a, b]
+  regex: (.*);(.*)
+  target_label: c
+  replacement: $2-$1`,
+			labels:   map[string]string{"a": "x", "b": "y"},
+			expected: map[string]string{"a": "x", "b": "y", "c": "y-x"},
+		},
+		{
+			name: "replace without match",
+			cfgs: `
+- source_labels: [a]
+  regex: z
+  target_label: c`,
+			labels:   map[string]string{"a": "x"},
+			expected: map[string]string{"a": "x"},
+		},
+		{
+			name: "replace with an empty value deletes the label",
+			cfgs: `
+- source_labels: [missing]
+  target_label: a`,
+			labels:   map[string]string{"a": "x"},
+			expected: map[string]string{},
+		},
+		{
+			name: "replace with a templated target label",
+			cfgs: `
+- source_labels: [a]
+  regex: (.*)
+  target_label: label_$1
+  replacement: v`,
+			labels:   map[string]string{"a": "x"},
+			expected: map[string]string{"a": "x", "label_x": "v"},
+		},
+		{
+			name: "keep matching",
+			cfgs: `
+- source_labels: [a]
+  regex: x
+  action: keep`,
+			labels:   map[string]string{"a": "x"},
+			expected: map[string]string{"a": "x"},
+		},
+		{
+			name: "keep not matching",
+			cfgs: `
+- source_labels: [a]
+  regex: y
+  action: keep`,
+			labels:   map[string]string{"a": "x"},
+			expected: nil,
+		},
+		{
+			name: "regex is anchored",
+			cfgs: `
+- source_labels: [a]
+  regex: x
+  action: keep`,
+			labels:   map[string]string{"a": "xx"},
+			expected: nil,
+		},
+		{
+			name: "drop matching",
+			cfgs: `
+- source_labels: [a]
+  regex: x
+  action: drop`,
+			labels:   map[string]string{"a": "x"},
+			expected: nil,
+		},
+		{
+			name: "drop not matching",
+			cfgs: `
+- source_labels: [a]
+  regex: y
+  action: drop`,
+			labels:   map[string]string{"a": "x"},
+			expected: map[string]string{"a": "x"},
+		},
+		{
+			name: "hashmod",
+			cfgs: `
+- source_labels: [__address__]
+  modulus: 10
+  target_label: shard
+  action: hashmod`,
+			labels:   map[string]string{"__address__": "h:1"},
+			expected: map[string]string{"__address__": "h:1", "shard": "9"},
+		},
+		{
+			name: "labelmap",
+			cfgs: `
+- regex: __meta_(.+)
+  action: labelmap`,
+			labels:   map[string]string{"__meta_env": "prod", "a": "x"},
+			expected: map[string]string{"__meta_env": "prod", "env": "prod", "a": "x"},
+		},
+		{
+			name: "labeldrop",
+			cfgs: `
+- regex: tmp_.*
+  action: labeldrop`,
+			labels:   map[string]string{"tmp_a": "x", "b": "y"},
+			expected: map[string]string{"b": "y"},
+		},
+		{
+			name: "labelkeep",
+			cfgs: `
+- regex: __address__|b
+  action: labelkeep`,
+			labels:   map[string]string{"__address__": "h:1", "a": "x", "b": "y"},
+			expected: map[string]string{"__address__": "h:1", "b": "y"},
+		},
+		{
+			name: "configs are applied in order",
+			cfgs: `
+- source_labels: [a]
+  target_label: b
+- source_labels: [b]
+  regex: x
+  action: drop`,
+			labels:   map[string]string{"a": "x"},
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		labels := Process(test.labels, parse(t, test.cfgs)...)
+		if !reflect.DeepEqual(labels, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, labels)
+		}
+	}
+}
+
+func TestProcessDoesNotModifyLabels(t *testing.T) {
+	labels := map[string]string{"a": "x"}
+	Process(labels, parse(t, `
+- source_labels: [a]
+  target_label: b`)...)
+	if !reflect.DeepEqual(labels, map[string]string{"a": "x"}) {
+		t.Errorf("expected the labels to be unchanged, got %v", labels)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		cfgs  string
+		valid bool
+	}{
+		{"- target_label: a", true},
+		{"- action: replace", false},
+		{"- target_label: 1a", false},
+		{"- action: hashmod\n  target_label: a", false},
+		{"- action: hashmod\n  target_label: a\n  modulus: 2", true},
+		{"- action: labelmap\n  replacement: 1a", false},
+		{"- action: unknown", false},
+		{"- regex: '('\n  action: keep", false},
+	}
+
+	for _, test := range tests {
+		var cfgs []Config
+		err := yaml.Unmarshal([]byte(test.cfgs), &cfgs)
+		if test.valid && err != nil {
+			t.Errorf("%q: unexpected error: %s", test.cfgs, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%q: expected an error", test.cfgs)
+		}
+	}
+}
+
+func TestRegexpMarshal(t *testing.T) {
+	cfgs := parse(t, "- regex: a|b\n  action: keep")
+	out, err := yaml.Marshal(cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back []Config
+	err = yaml.Unmarshal(out, &back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back[0].Regex.original != "a|b" {
+		t.Errorf("expected the regex to keep its original form, got %q in %s", back[0].Regex.original, out)
+	}
+}
+
+func TestIsValidLabelName(t *testing.T) {
+	tests := map[string]bool{
+		"env":         true,
+		"_env":        true,
+		"__address__": true,
+		"env_2":       true,
+		"":            false,
+		"2env":        false,
+		"env-name":    false,
+		"env.name":    false,
+	}
+
+	for name, valid := range tests {
+		if got := IsValidLabelName(name); got != valid {
+			t.Errorf("%q: expected %v, got %v", name, valid, got)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/cryptobioz/prometheus-service-discovery/aggregator"
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/cache"
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+	"github.com/cryptobioz/prometheus-service-discovery/metrics"
+	"github.com/cryptobioz/prometheus-service-discovery/validation"
+	"github.com/cryptobioz/prometheus-service-discovery/web"
+)
+
+// runningBackend is a backend instance which is being polled
+type runningBackend struct {
+	instance config.Backend
+	runner   *backends.Runner
+}
+
+// daemon holds the running configuration and backends. The discovered
+// targets are stored in the aggregator.
+type daemon struct {
+	ctx       context.Context
+	path      string
+	cfg       config.Config
+	agg       *aggregator.Aggregator
+	updates   <-chan struct{}
+	running   map[string]*runningBackend
+	instances map[string]config.Backend
+	cached    map[string]uint64
+	writer    *writer
+	web       *web.Server
+
+	// stopWriter cancels the writer started by startWriter
+	stopWriter context.CancelFunc
+
+	// watchInterval is the `watch_interval` of the configuration, read
+	// by watchConfig, which is woken up by watchReset when it changes
+	watchInterval int64
+	watchReset    chan struct{}
+}
+
+func newDaemon(ctx context.Context, path string) *daemon {
+	d := &daemon{
+		ctx:       ctx,
+		path:      path,
+		agg:       aggregator.New(),
+		running:   make(map[string]*runningBackend),
+		instances: make(map[string]config.Backend),
+		cached:    make(map[string]uint64),
+		writer:    newWriter(),
+		web:       web.New(),
+
+		watchReset: make(chan struct{}, 1),
+	}
+	d.updates = d.agg.Subscribe()
+	d.web.Handle("/metrics", metrics.Handler())
+	return d
+}
+
+// load applies a configuration: backends which were removed or changed are
+// stopped, new or changed backends are started and unchanged backends keep
+// running with their last data. Nothing is applied if the configuration is
+// invalid.
+func (d *daemon) load(y []byte) (err error) {
+	cfg, err := config.LoadConfig(y)
+	if err != nil {
+		return
+	}
+
+	instances, err := config.LoadBackends(y)
+	if err != nil {
+		return
+	}
+
+	wanted := make(map[string]bool)
+	var started []config.Backend
+	for _, inst := range instances {
+		wanted[inst.Key] = true
+		if r, ok := d.running[inst.Key]; ok && r.instance.Fingerprint == inst.Fingerprint {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"backend": inst.Backend.GetName(),
+			"id":      inst.Backend.GetID(),
+		}).Info("Initializing backend...")
+		err = inst.Backend.New()
+		if err != nil {
+			return fmt.Errorf("failed to initialize %s backend `%s`: %s", inst.Backend.GetName(), inst.Backend.GetID(), err)
+		}
+		started = append(started, inst)
+	}
+
+	for key, r := range d.running {
+		if !wanted[key] {
+			d.stopBackend(r)
+			d.agg.Remove(key)
+			delete(d.cached, key)
+			backends.Forget(r.instance.Backend.GetName(), r.instance.Backend.GetID())
+			staleTargets.Delete(r.instance.Backend.GetName(), r.instance.Backend.GetID())
+			if cfg.Config.StateDir != "" {
+				err := cache.Remove(cfg.Config.StateDir, r.instance.Backend.GetName(), r.instance.Backend.GetID())
+				if err != nil {
+					log.Errorf("failed to remove cached data: %s", err)
+				}
+			}
+		}
+	}
+
+	for _, inst := range started {
+		if r, ok := d.running[inst.Key]; ok {
+			d.stopBackend(r)
+		}
+		d.startBackend(inst)
+	}
+
+	if d.cfg.Config.Web.ListenAddress != "" && cfg.Config.Web.ListenAddress != d.cfg.Config.Web.ListenAddress {
+		log.Warn("Changing `web.listen_address` requires a restart")
+	}
+
+	d.setInstances(instances)
+
+	if cfg.Config.WatchInterval != d.cfg.Config.WatchInterval {
+		atomic.StoreInt64(&d.watchInterval, int64(cfg.Config.WatchInterval))
+		select {
+		case d.watchReset <- struct{}{}:
+		default:
+		}
+	}
+
+	d.cfg = cfg
+	d.writer.configure(cfg.Config.Write.Debounce, cfg.Config.Write.MinInterval, cfg.Config.Write.MaxDelay)
+	configReloadSuccessful.Set(1)
+	configReloadTimestamp.Set(float64(time.Now().Unix()))
+	return
+}
+
+// reload re-reads the configuration file and keeps the current
+// configuration if the new one is invalid
+func (d *daemon) reload() {
+	y, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		configReloadSuccessful.Set(0)
+		log.Errorf("failed to read config file, keeping current configuration: %s", err)
+		return
+	}
+
+	err = d.load(y)
+	if err != nil {
+		configReloadSuccessful.Set(0)
+		log.Errorf("failed to reload config, keeping current configuration: %s", err)
+		return
+	}
+	log.Info("Configuration reloaded")
+	d.refresh()
+}
+
+// publisher returns the publisher of a backend instance, which handles an
+// empty discovery as a failure if configured to
+func (d *daemon) publisher(inst config.Backend) backends.Publisher {
+	return backends.PublisherFunc(func(data backends.BackendData) {
+		if data.Err == nil && inst.Stale.EmptyIsFailure && backends.CountTargets(data.Jobs) == 0 {
+			data.Jobs = nil
+			data.Err = fmt.Errorf("discovery returned no target")
+		}
+
+		if data.Err != nil {
+			if s, ok := d.agg.Get(inst.Key); ok && s.HasData {
+				log.WithFields(log.Fields{
+					"backend": data.Backend,
+					"id":      data.ID,
+				}).Warnf("Discovery failed, serving the last targets as stale: %s", data.Err)
+			}
+		}
+		d.agg.Publish(data)
+	})
+}
+
+// save caches the data of the backends which changed since they were last
+// cached
+func (d *daemon) save(snap aggregator.Snapshot) {
+	if d.cfg.Config.StateDir == "" {
+		return
+	}
+
+	for key, s := range snap.States {
+		if !s.HasData || s.Restored || s.DataVersion <= d.cached[key] {
+			continue
+		}
+
+		d.cached[key] = s.DataVersion
+		err := cache.Save(d.cfg.Config.StateDir, s.Data, s.Discovered)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"backend": s.Data.Backend,
+				"id":      s.Data.ID,
+			}).Errorf("failed to cache discovered targets: %s", err)
+		}
+	}
+}
+
+// restore loads the cached data of the configured backends which did not
+// publish yet
+func (d *daemon) restore() {
+	if d.cfg.Config.StateDir == "" {
+		return
+	}
+
+	for _, inst := range d.instances {
+		logger := log.WithFields(log.Fields{
+			"backend": inst.Backend.GetName(),
+			"id":      inst.Backend.GetID(),
+		})
+		data, discovered, ok, err := cache.Load(d.cfg.Config.StateDir, inst.Backend.GetName(), inst.Backend.GetID(), d.cfg.Config.CacheMaxAge*time.Second)
+		if err != nil {
+			logger.Errorf("failed to load cached targets: %s", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		if d.agg.Restore(data, discovered) {
+			logger.Info("Restored targets from cache")
+		}
+	}
+}
+
+// setInstances records the configured backend instances
+func (d *daemon) setInstances(instances []config.Backend) {
+	d.instances = make(map[string]config.Backend, len(instances))
+	for _, inst := range instances {
+		d.instances[inst.Key] = inst
+	}
+	d.web.SetBackends(instances)
+}
+
+// process marks the targets of failing backends as stale or drops them once
+// expired, merges the job template of each backend instance into its jobs,
+// injects the configured labels in the discovered targets, then applies the
+// relabel configs of the backend instance and the global ones
+func (d *daemon) process(snap aggregator.Snapshot) map[string]backends.BackendData {
+	processed := make(map[string]backends.BackendData, len(snap.States))
+	for key, s := range snap.States {
+		if !s.HasData {
+			continue
+		}
+
+		data := s.Data
+		stale := 0
+		if since := s.Failing; !since.IsZero() {
+			if d.expired(key, since) {
+				staleTargets.Set(0, data.Backend, data.ID)
+				continue
+			}
+			data.Jobs = backends.MarkStale(data.Jobs)
+			stale = backends.CountTargets(data.Jobs)
+		}
+		staleTargets.Set(float64(stale), data.Backend, data.ID)
+
+		data.Jobs = d.instances[key].JobTemplate.Apply(data.Jobs)
+		labels, override := d.instances[key].InjectedLabels(d.cfg)
+		data.Jobs = backends.InjectLabels(data.Jobs, labels, override)
+		data.Jobs = backends.Relabel(data.Jobs, d.instances[key].RelabelConfigs)
+		data.Jobs = backends.Relabel(data.Jobs, d.cfg.Config.RelabelConfigs)
+		processed[key] = data
+	}
+	return processed
+}
+
+// expired reports whether the stale targets of a backend failing since the
+// given time must be dropped
+func (d *daemon) expired(key string, since time.Time) bool {
+	stale := d.instances[key].Stale
+	return stale.Policy == config.StalePolicyDrop && time.Since(since) >= stale.TTL*time.Second
+}
+
+// staleExpiry returns a channel which fires when the stale targets of a
+// backend must be dropped, or nil if no stale targets expire
+func (d *daemon) staleExpiry() <-chan time.Time {
+	var next time.Time
+	for key, s := range d.agg.Snapshot().States {
+		if !s.HasData || s.Failing.IsZero() || d.instances[key].Stale.Policy != config.StalePolicyDrop {
+			continue
+		}
+		expiry := s.Failing.Add(d.instances[key].Stale.TTL * time.Second)
+		if expiry.After(time.Now()) && (next.IsZero() || expiry.Before(next)) {
+			next = expiry
+		}
+	}
+
+	if next.IsZero() {
+		return nil
+	}
+	return time.After(time.Until(next))
+}
+
+// refresh caches, processes and validates the current snapshot of the
+// discovered targets, and publishes it to the HTTP server and the outputs
+func (d *daemon) refresh() {
+	snap := d.agg.Snapshot()
+	d.save(snap)
+
+	valid := validation.Validate(d.process(snap))
+	d.web.Update(valid)
+	d.writer.changed(d.cfg.Config.Output, valid)
+}
+
+// startWriter writes the outputs in a new goroutine until shutdown
+func (d *daemon) startWriter() {
+	ctx, cancel := context.WithCancel(d.ctx)
+	d.stopWriter = cancel
+	go d.writer.run(ctx)
+}
+
+func (d *daemon) startBackend(inst config.Backend) {
+	d.running[inst.Key] = &runningBackend{
+		instance: inst,
+		runner:   backends.Run(d.ctx, inst.Backend, d.publisher(inst)),
+	}
+}
+
+// stopBackend stops a backend and waits for its goroutine to return
+func (d *daemon) stopBackend(r *runningBackend) {
+	log.WithFields(log.Fields{
+		"backend": r.instance.Backend.GetName(),
+		"id":      r.instance.Backend.GetID(),
+	}).Info("Stopping backend...")
+	r.runner.Stop()
+	delete(d.running, r.instance.Key)
+}
+
+// shutdown stops every running backend and the writer, cancelling the
+// running write if any
+func (d *daemon) shutdown() {
+	for _, r := range d.running {
+		d.stopBackend(r)
+	}
+	if d.stopWriter != nil {
+		d.stopWriter()
+		d.writer.wait()
+	}
+}
+
+// configWatchInterval returns the interval between two checks of the
+// configuration file
+func (d *daemon) configWatchInterval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&d.watchInterval)) * time.Second
+}
+
+// watchConfig notifies changed when the modification time or the size of
+// the configuration file changes. The interval is read before every check,
+// and a value sent to reset applies a new interval immediately.
+func watchConfig(path string, interval func() time.Duration, reset <-chan struct{}, changed chan<- struct{}) {
+	var last os.FileInfo
+	for {
+		fi, err := os.Stat(path)
+		if err != nil {
+			log.Debugf("failed to stat config file: %s", err)
+		} else {
+			if last != nil && (!fi.ModTime().Equal(last.ModTime()) || fi.Size() != last.Size()) {
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+			last = fi
+		}
+
+		select {
+		case <-time.After(interval()):
+		case <-reset:
+		}
+	}
+}
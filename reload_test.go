@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+)
+
+// fakeBackend discovers a single target. Its initialization fails if it is
+// marked as broken.
+type fakeBackend struct {
+	ID     string `yaml:"id"`
+	Target string `yaml:"target"`
+	Broken bool   `yaml:"broken"`
+}
+
+func init() {
+	backends.Register("fake", func() backends.BackendInterface { return &fakeBackend{} })
+}
+
+func (b *fakeBackend) New() error {
+	if b.Broken {
+		return fmt.Errorf("broken backend")
+	}
+	return nil
+}
+
+func (b *fakeBackend) Discover(context.Context) ([]backends.JobConfig, error) {
+	return []backends.JobConfig{{
+		JobName:       b.ID,
+		StaticConfigs: []backends.StaticConfig{{Targets: []string{b.Target}}},
+	}}, nil
+}
+
+func (b *fakeBackend) GetName() string { return "fake" }
+func (b *fakeBackend) GetID() string   { return b.ID }
+
+func TestLoad(t *testing.T) {
+	d := newDaemon(context.Background(), "")
+	defer d.shutdown()
+
+	err := d.load([]byte(`
+backends:
+  fake:
+    - {id: unchanged, target: "a:1"}
+    - {id: changed, target: "b:1"}
+    - {id: removed, target: "c:1"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchanged, changed := d.running["fake_unchanged"], d.running["fake_changed"]
+
+	err = d.load([]byte(`
+config:
+  watch_interval: 10
+backends:
+  fake:
+    - {id: unchanged, target: "a:1"}
+    - {id: changed, target: "b:2"}
+    - {id: added, target: "d:1"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.running) != 3 {
+		t.Errorf("expected 3 running backends, got %d", len(d.running))
+	}
+	if d.running["fake_unchanged"] != unchanged {
+		t.Error("expected the unchanged backend to keep running")
+	}
+	if r := d.running["fake_changed"]; r == nil || r == changed {
+		t.Error("expected the changed backend to be restarted")
+	}
+	if _, ok := d.running["fake_removed"]; ok {
+		t.Error("expected the removed backend to be stopped")
+	}
+	if _, ok := d.running["fake_added"]; !ok {
+		t.Error("expected the added backend to be started")
+	}
+
+	running := make(map[string]*runningBackend)
+	for key, r := range d.running {
+		running[key] = r
+	}
+
+	// An invalid configuration leaves the running backends untouched
+	for _, y := range []string{
+		"backends:\n  fake:\n    - {id: unchanged, target: \"a:2\"}\n  unknown:\n    - {id: a}\n",
+		"backends:\n  fake:\n    - {id: unchanged, target: \"a:2\"}\n    - {id: broken, broken: true}\n",
+		"config:\n  watch_interval: -1\nbackends:\n  fake:\n    - {id: unchanged, target: \"a:2\"}\n",
+	} {
+		err = d.load([]byte(y))
+		if err == nil {
+			t.Errorf("expected an error for:\n%s", y)
+		}
+		if len(d.running) != len(running) {
+			t.Errorf("expected %d running backends, got %d", len(running), len(d.running))
+		}
+		for key, r := range running {
+			if d.running[key] != r {
+				t.Errorf("expected backend %s to keep running", key)
+			}
+		}
+		if d.cfg.Config.WatchInterval != 10 {
+			t.Errorf("expected the configuration to be kept, got watch_interval %d", d.cfg.Config.WatchInterval)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"time"
+)
+
+// writeScheduler decides when the pending changes are written: once no
+// change arrived for debounce, but at most maxDelay after the first pending
+// change. minInterval between two writes takes precedence over maxDelay.
+type writeScheduler struct {
+	debounce    time.Duration
+	minInterval time.Duration
+	maxDelay    time.Duration
+
+	first     time.Time
+	last      time.Time
+	lastWrite time.Time
+}
+
+// configure applies the write settings of the configuration
+func (s *writeScheduler) configure(debounce, minInterval, maxDelay time.Duration) {
+	s.debounce = debounce * time.Second
+	s.minInterval = minInterval * time.Second
+	s.maxDelay = maxDelay * time.Second
+}
+
+// changed records a change to write
+func (s *writeScheduler) changed(now time.Time) {
+	if s.first.IsZero() {
+		s.first = now
+	} else {
+		writesCoalesced.Inc()
+	}
+	s.last = now
+}
+
+// written records a write, which includes every pending change
+func (s *writeScheduler) written(now time.Time) {
+	s.first = time.Time{}
+	s.last = time.Time{}
+	s.lastWrite = now
+}
+
+// due returns when the pending changes must be written
+func (s *writeScheduler) due() time.Time {
+	t := s.last.Add(s.debounce)
+	if max := s.first.Add(s.maxDelay); max.Before(t) {
+		t = max
+	}
+	if next := s.lastWrite.Add(s.minInterval); next.After(t) {
+		t = next
+	}
+	return t
+}
+
+// timer returns a channel which fires when the pending changes must be
+// written, or nil if there are none
+func (s *writeScheduler) timer() <-chan time.Time {
+	if s.first.IsZero() {
+		return nil
+	}
+	return time.After(time.Until(s.due()))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWriteSchedulerDue(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+
+	tests := []struct {
+		name                            string
+		debounce, minInterval, maxDelay time.Duration
+		lastWrite                       int
+		changes                         []int
+		expected                        int
+	}{
+		{"immediate", 0, 0, 60, -100, []int{0}, 0},
+		{"debounced", 5, 0, 60, -100, []int{0}, 5},
+		{"debounce restarts on each change", 5, 0, 60, -100, []int{0, 3, 6}, 11},
+		{"capped by max delay", 5, 0, 10, -100, []int{0, 4, 8, 12}, 10},
+		{"delayed by min interval", 5, 30, 60, -10, []int{0}, 20},
+		{"min interval elapsed", 5, 30, 60, -100, []int{0}, 5},
+		{"min interval wins over max delay", 0, 30, 15, -10, []int{0}, 20},
+		{"min interval after the max delay cap", 5, 30, 10, -10, []int{0, 4, 8, 12}, 20},
+	}
+
+	for _, test := range tests {
+		var s writeScheduler
+		s.configure(test.debounce, test.minInterval, test.maxDelay)
+		s.written(at(test.lastWrite))
+		for _, c := range test.changes {
+			s.changed(at(c))
+		}
+		if due := s.due(); !due.Equal(at(test.expected)) {
+			t.Errorf("%s: expected %s, got %s", test.name, at(test.expected), due)
+		}
+	}
+}
+
+func TestWriteSchedulerWritten(t *testing.T) {
+	var s writeScheduler
+	s.configure(5, 0, 60)
+	if s.timer() != nil {
+		t.Error("expected no timer without pending changes")
+	}
+
+	now := time.Now()
+	s.changed(now)
+	if s.timer() == nil {
+		t.Error("expected a timer with pending changes")
+	}
+
+	s.written(now)
+	if s.timer() != nil {
+		t.Error("expected no timer once the changes are written")
+	}
+}
@@ -0,0 +1,290 @@
+package validation
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+	"github.com/cryptobioz/prometheus-service-discovery/metrics"
+	"github.com/cryptobioz/prometheus-service-discovery/relabel"
+)
+
+// Reasons for dropping a job or a target
+const (
+	ReasonDuplicateJobName = "duplicate_job_name"
+	ReasonInvalidJobName   = "invalid_job_name"
+	ReasonInvalidScheme    = "invalid_scheme"
+	ReasonInvalidLabelName = "invalid_label_name"
+	ReasonReservedLabel    = "reserved_label"
+	ReasonInvalidTarget    = "invalid_target"
+	ReasonInvalidDuration  = "invalid_duration"
+)
+
+var durationRE = regexp.MustCompile("^(([0-9]+)y)?(([0-9]+)w)?(([0-9]+)d)?(([0-9]+)h)?(([0-9]+)m)?(([0-9]+)s)?(([0-9]+)ms)?$")
+
+// allowedReservedLabels are the labels starting with `__` which a target
+// may set to change how it is scraped
+var allowedReservedLabels = map[string]bool{
+	"__scheme__":          true,
+	"__metrics_path__":    true,
+	"__scrape_interval__": true,
+	"__scrape_timeout__":  true,
+}
+
+// allowedReservedPrefixes are the prefixes of the labels starting with `__`
+// which a target may set
+var allowedReservedPrefixes = []string{"__param_", "__meta_"}
+
+// reasons are every reason for dropping an item
+var reasons = []string{
+	ReasonDuplicateJobName,
+	ReasonInvalidJobName,
+	ReasonInvalidScheme,
+	ReasonInvalidLabelName,
+	ReasonReservedLabel,
+	ReasonInvalidTarget,
+	ReasonInvalidDuration,
+}
+
+var dropped = metrics.NewGaugeVec(
+	"psd_validation_dropped",
+	"Number of jobs, target groups and targets currently dropped by the validation.",
+	"backend", "id", "reason",
+)
+
+// reported stores the items dropped from each backend by the previous
+// validation, indexed by backend key, as the same data is validated again
+// on every refresh
+var (
+	reportedMu sync.Mutex
+	reported   = make(map[string]report)
+)
+
+type report struct {
+	backend, id string
+	items       string
+}
+
+// Validate returns a copy of the backends data without the jobs, target
+// groups and targets which Prometheus would reject. The dropped items are
+// exposed as a gauge, and logged when they differ from the previous
+// validation. When several jobs have the same name, the one of the first
+// backend in (backend, ID) order is kept.
+func Validate(data map[string]backends.BackendData) map[string]backends.BackendData {
+	valid := make(map[string]backends.BackendData, len(data))
+	jobNames := make(map[string]string)
+
+	reportedMu.Lock()
+	defer reportedMu.Unlock()
+
+	for _, d := range backends.SortData(data) {
+		v := &validator{data: d}
+		jobs := make([]backends.JobConfig, 0, len(d.Jobs))
+		for _, job := range d.Jobs {
+			if owner, ok := jobNames[job.JobName]; ok {
+				v.drop(ReasonDuplicateJobName, log.Fields{"job": job.JobName}, "job name is already used by %s", owner)
+				continue
+			}
+
+			job, ok := v.job(job)
+			if !ok {
+				continue
+			}
+			jobNames[job.JobName] = fmt.Sprintf("%s backend `%s`", d.Backend, d.ID)
+			jobs = append(jobs, job)
+		}
+
+		d.Jobs = jobs
+		key := config.BackendKey(d.Backend, d.ID)
+		valid[key] = d
+		v.report(key)
+	}
+
+	for key, r := range reported {
+		if _, ok := valid[key]; !ok {
+			for _, reason := range reasons {
+				dropped.Delete(r.backend, r.id, reason)
+			}
+			delete(reported, key)
+		}
+	}
+	return valid
+}
+
+type validator struct {
+	data  backends.BackendData
+	items []droppedItem
+}
+
+type droppedItem struct {
+	reason  string
+	fields  log.Fields
+	message string
+}
+
+func (v *validator) drop(reason string, fields log.Fields, format string, args ...interface{}) {
+	fields["backend"] = v.data.Backend
+	fields["id"] = v.data.ID
+	fields["reason"] = reason
+	v.items = append(v.items, droppedItem{reason, fields, fmt.Sprintf(format, args...)})
+}
+
+// report sets the gauge of the dropped items of the backend, and logs them
+// if they changed since the previous validation. reportedMu must be held.
+func (v *validator) report(key string) {
+	counts := make(map[string]int)
+	items := make([]string, 0, len(v.items))
+	for _, item := range v.items {
+		counts[item.reason]++
+		items = append(items, fmt.Sprintf("%v %s", item.fields, item.message))
+	}
+	for _, reason := range reasons {
+		dropped.Set(float64(counts[reason]), v.data.Backend, v.data.ID, reason)
+	}
+
+	r := report{backend: v.data.Backend, id: v.data.ID, items: strings.Join(items, "\n")}
+	if r == reported[key] {
+		return
+	}
+	reported[key] = r
+	for _, item := range v.items {
+		log.WithFields(item.fields).Warnf("Dropping invalid discovered item: %s", item.message)
+	}
+}
+
+// job validates a job and its static configs. It returns false if the
+// whole job must be dropped.
+func (v *validator) job(job backends.JobConfig) (backends.JobConfig, bool) {
+	fields := log.Fields{"job": job.JobName}
+
+	if strings.TrimSpace(job.JobName) == "" {
+		v.drop(ReasonInvalidJobName, fields, "job name is empty")
+		return job, false
+	}
+
+	if !validScheme(job.Scheme) {
+		v.drop(ReasonInvalidScheme, fields, "invalid scheme `%s`", job.Scheme)
+		return job, false
+	}
+
+	for name, value := range map[string]string{"scrape_interval": job.ScrapeInterval, "scrape_timeout": job.ScrapeTimeout} {
+		if !validDuration(value) {
+			v.drop(ReasonInvalidDuration, fields, "invalid %s `%s`", name, value)
+			return job, false
+		}
+	}
+
+	staticConfigs := make([]backends.StaticConfig, 0, len(job.StaticConfigs))
+	for _, sc := range job.StaticConfigs {
+		sc, ok := v.staticConfig(job.JobName, sc)
+		if ok {
+			staticConfigs = append(staticConfigs, sc)
+		}
+	}
+	job.StaticConfigs = staticConfigs
+	return job, true
+}
+
+// staticConfig validates the labels and the targets of a target group. It
+// returns false if the whole group must be dropped.
+func (v *validator) staticConfig(jobName string, sc backends.StaticConfig) (backends.StaticConfig, bool) {
+	for name, value := range sc.Labels {
+		fields := log.Fields{"job": jobName, "label": name, "targets": strings.Join(sc.Targets, ",")}
+
+		if !relabel.IsValidLabelName(name) {
+			v.drop(ReasonInvalidLabelName, fields, "invalid label name")
+			return sc, false
+		}
+
+		if reservedLabel(name) {
+			v.drop(ReasonReservedLabel, fields, "label name is reserved")
+			return sc, false
+		}
+
+		if name == "__scheme__" && !validScheme(value) {
+			v.drop(ReasonInvalidScheme, fields, "invalid scheme `%s`", value)
+			return sc, false
+		}
+
+		if (name == "__scrape_interval__" || name == "__scrape_timeout__") && (value == "" || !validDuration(value)) {
+			v.drop(ReasonInvalidDuration, fields, "invalid duration `%s`", value)
+			return sc, false
+		}
+	}
+
+	targets := make([]string, 0, len(sc.Targets))
+	for _, target := range sc.Targets {
+		err := validTarget(target)
+		if err != nil {
+			v.drop(ReasonInvalidTarget, log.Fields{"job": jobName, "target": target}, "%s", err)
+			continue
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 && len(sc.Targets) > 0 {
+		return sc, false
+	}
+
+	return backends.StaticConfig{
+		Targets: targets,
+		Labels:  sc.Labels,
+	}, true
+}
+
+func reservedLabel(name string) bool {
+	if !strings.HasPrefix(name, "__") || allowedReservedLabels[name] {
+		return false
+	}
+	for _, prefix := range allowedReservedPrefixes {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// validDuration checks that a duration uses the Prometheus format. An empty
+// duration is valid, as it is the default.
+func validDuration(d string) bool {
+	return d == "" || (d != "0" && durationRE.MatchString(d))
+}
+
+func validScheme(scheme string) bool {
+	return scheme == "" || scheme == "http" || scheme == "https"
+}
+
+// validTarget checks that a target is a `host` or a `host:port`
+func validTarget(target string) error {
+	if target == "" {
+		return fmt.Errorf("target is empty")
+	}
+	if strings.ContainsAny(target, "/ \t\n") {
+		return fmt.Errorf("target is not a host:port")
+	}
+
+	host, port := target, ""
+	if strings.Contains(target, ":") {
+		var err error
+		host, port, err = net.SplitHostPort(target)
+		if err != nil {
+			return fmt.Errorf("target is not a host:port: %s", err)
+		}
+
+		p, err := strconv.Atoi(port)
+		if err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("invalid port `%s`", port)
+		}
+	}
+
+	if host == "" {
+		return fmt.Errorf("host is empty")
+	}
+	return nil
+}
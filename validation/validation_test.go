@@ -0,0 +1,162 @@
+package validation
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+	"github.com/cryptobioz/prometheus-service-discovery/metrics"
+)
+
+func TestValidateDuplicateJobNames(t *testing.T) {
+	job := backends.JobConfig{
+		JobName:       "node",
+		StaticConfigs: []backends.StaticConfig{{Targets: []string{"h:1"}}},
+	}
+	data := map[string]backends.BackendData{
+		config.BackendKey("static", "b"):   {Backend: "static", ID: "b", Jobs: []backends.JobConfig{job}},
+		config.BackendKey("puppetdb", "a"): {Backend: "puppetdb", ID: "a", Jobs: []backends.JobConfig{job, job}},
+	}
+
+	valid := Validate(data)
+	if n := len(valid[config.BackendKey("puppetdb", "a")].Jobs); n != 1 {
+		t.Errorf("expected the first backend to keep one job, got %d", n)
+	}
+	if n := len(valid[config.BackendKey("static", "b")].Jobs); n != 0 {
+		t.Errorf("expected the duplicate job of the second backend to be dropped, got %d jobs", n)
+	}
+}
+
+func TestValidateJobs(t *testing.T) {
+	tests := []struct {
+		name  string
+		job   backends.JobConfig
+		valid bool
+	}{
+		{"valid", backends.JobConfig{JobName: "a", Scheme: "https", ScrapeInterval: "1m30s"}, true},
+		{"empty job name", backends.JobConfig{JobName: " "}, false},
+		{"invalid scheme", backends.JobConfig{JobName: "a", Scheme: "ftp"}, false},
+		{"invalid scrape interval", backends.JobConfig{JobName: "a", ScrapeInterval: "10"}, false},
+		{"zero scrape timeout", backends.JobConfig{JobName: "a", ScrapeTimeout: "0"}, false},
+	}
+
+	for _, test := range tests {
+		valid := Validate(map[string]backends.BackendData{
+			"static_a": {Backend: "static", ID: "a", Jobs: []backends.JobConfig{test.job}},
+		})
+		if got := len(valid["static_a"].Jobs) == 1; got != test.valid {
+			t.Errorf("%s: expected valid=%v, got %v", test.name, test.valid, got)
+		}
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		valid  bool
+	}{
+		{map[string]string{"env": "prod"}, true},
+		{map[string]string{"1env": "prod"}, false},
+		{map[string]string{"env-name": "prod"}, false},
+		{map[string]string{"__address__": "h:1"}, false},
+		{map[string]string{"__name__": "up"}, false},
+		{map[string]string{"__scheme__": "https"}, true},
+		{map[string]string{"__scheme__": "ftp"}, false},
+		{map[string]string{"__metrics_path__": "/m"}, true},
+		{map[string]string{"__scrape_interval__": "30s"}, true},
+		{map[string]string{"__scrape_timeout__": ""}, false},
+		{map[string]string{"__param_module": "http_2xx"}, true},
+		{map[string]string{"__param_": "x"}, false},
+		{map[string]string{"__meta_psd_stale": "true"}, true},
+	}
+
+	for _, test := range tests {
+		valid := Validate(map[string]backends.BackendData{
+			"static_a": {Backend: "static", ID: "a", Jobs: []backends.JobConfig{{
+				JobName: "a",
+				StaticConfigs: []backends.StaticConfig{
+					{Targets: []string{"h:1"}, Labels: test.labels},
+				},
+			}}},
+		})
+		if got := len(valid["static_a"].Jobs[0].StaticConfigs) == 1; got != test.valid {
+			t.Errorf("%v: expected valid=%v, got %v", test.labels, test.valid, got)
+		}
+	}
+}
+
+func TestValidateTargets(t *testing.T) {
+	tests := []struct {
+		target string
+		valid  bool
+	}{
+		{"host", true},
+		{"host:9100", true},
+		{"10.0.0.1:80", true},
+		{"[::1]:9100", true},
+		{"", false},
+		{"host:", false},
+		{":9100", false},
+		{"host:0", false},
+		{"host:65536", false},
+		{"host:http", false},
+		{"http://host:9100", false},
+		{"host:9100/metrics", false},
+		{"ho st:9100", false},
+	}
+
+	for _, test := range tests {
+		if err := validTarget(test.target); (err == nil) != test.valid {
+			t.Errorf("%q: expected valid=%v, got error %v", test.target, test.valid, err)
+		}
+	}
+
+	// Invalid targets are dropped from their group, and a group without
+	// any valid target is dropped
+	valid := Validate(map[string]backends.BackendData{
+		"static_a": {Backend: "static", ID: "a", Jobs: []backends.JobConfig{{
+			JobName: "a",
+			StaticConfigs: []backends.StaticConfig{
+				{Targets: []string{"h:1", "h:0"}},
+				{Targets: []string{"h:x"}},
+			},
+		}}},
+	})
+	expected := []backends.StaticConfig{{Targets: []string{"h:1"}}}
+	if got := valid["static_a"].Jobs[0].StaticConfigs; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func exposition() string {
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestValidateDroppedGauge(t *testing.T) {
+	data := map[string]backends.BackendData{
+		"static_gauge": {Backend: "static", ID: "gauge", Jobs: []backends.JobConfig{{
+			JobName: "gauge",
+			StaticConfigs: []backends.StaticConfig{
+				{Targets: []string{"h:1", "h:0", "h:x"}},
+			},
+		}}},
+	}
+	series := `psd_validation_dropped{backend="static",id="gauge",reason="invalid_target"}`
+
+	// Validating the same data again must not count its items twice
+	Validate(data)
+	Validate(data)
+	if out := exposition(); !strings.Contains(out, series+" 2\n") {
+		t.Errorf("expected 2 dropped targets, got:\n%s", out)
+	}
+
+	Validate(map[string]backends.BackendData{})
+	if out := exposition(); strings.Contains(out, series) {
+		t.Errorf("expected the series of the removed backend to be deleted, got:\n%s", out)
+	}
+}
@@ -0,0 +1,80 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+)
+
+// SetStartupDeadline sets the time after which the server is ready even if
+// some backends did not complete their first discovery
+func (s *Server) SetStartupDeadline(deadline time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deadline = deadline
+}
+
+// Ready reports whether every configured backend completed its first
+// discovery or the startup deadline is exceeded. Once ready, the server
+// stays ready.
+func (s *Server) Ready() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ready {
+		return true
+	}
+
+	if !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		s.ready = true
+		return true
+	}
+
+	for _, inst := range s.configured {
+		if backends.GetStatus(inst.Backend.GetName(), inst.Backend.GetID()).LastSuccess == nil {
+			return false
+		}
+	}
+	s.ready = true
+	return true
+}
+
+// Statuses returns the status of every configured backend instance
+func (s *Server) Statuses() []backends.Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statuses := make([]backends.Status, 0, len(s.configured))
+	for _, inst := range s.configured {
+		statuses = append(statuses, backends.GetStatus(inst.Backend.GetName(), inst.Backend.GetID()))
+	}
+	return statuses
+}
+
+func (s *Server) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+func (s *Server) serveReady(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !s.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("not ready\n"))
+		return
+	}
+	w.Write([]byte("ready\n"))
+}
+
+func (s *Server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	body, err := json.MarshalIndent(s.Statuses(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,180 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+)
+
+const uiTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Prometheus service discovery</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: .3em .6em; text-align: left; vertical-align: top; }
+.label { display: inline-block; background: #eee; border-radius: 3px; padding: 0 .3em; margin: 0 .2em .2em 0; font-family: monospace; }
+.error { color: #b00; }
+.meta { color: #666; }
+</style>
+</head>
+<body>
+<h1>Prometheus service discovery</h1>
+<form method="get">
+<input type="text" name="q" value="{{.Query}}" placeholder="Search">
+<input type="text" name="label" value="{{.Label}}" placeholder="name=value">
+<input type="submit" value="Filter">
+<a href="?">Reset</a>
+</form>
+{{range .Backends}}
+<h2>{{.Status.Backend}} / {{.Status.ID}}</h2>
+<p class="meta">
+Output last changed: {{if .Changed.IsZero}}never{{else}}{{.Changed.Format "2006-01-02 15:04:05 MST"}}{{end}}
+&middot; Targets: {{.Status.Targets}}
+{{if .Status.LastError}}&middot; <span class="error">Last error: {{.Status.LastError}} ({{.Status.ConsecutiveFailures}} consecutive failures)</span>{{end}}
+</p>
+{{if .Jobs}}
+<table>
+<tr><th>Job</th><th>Target</th><th>Labels</th></tr>
+{{range $job := .Jobs}}{{range .Targets}}
+<tr><td>{{$job.Name}}</td><td>{{.Target}}</td><td>{{range .Labels}}<span class="label">{{.Name}}="{{.Value}}"</span>{{end}}</td></tr>
+{{end}}{{end}}
+</table>
+{{else}}
+<p class="meta">No targets.</p>
+{{end}}
+{{end}}
+</body>
+</html>
+`
+
+var ui = template.Must(template.New("ui").Parse(uiTemplate))
+
+type uiLabel struct {
+	Name, Value string
+}
+
+type uiTarget struct {
+	Target string
+	Labels []uiLabel
+}
+
+type uiJob struct {
+	Name    string
+	Targets []uiTarget
+}
+
+type uiBackend struct {
+	Status  backends.Status
+	Changed time.Time
+	Jobs    []uiJob
+}
+
+// filter selects the targets matching a text search and a name=value label
+type filter struct {
+	query      string
+	labelName  string
+	labelValue string
+}
+
+func newFilter(r *http.Request) filter {
+	f := filter{query: strings.TrimSpace(r.FormValue("q"))}
+	if label := strings.TrimSpace(r.FormValue("label")); label != "" {
+		parts := strings.SplitN(label, "=", 2)
+		f.labelName = strings.TrimSpace(parts[0])
+		if len(parts) == 2 {
+			f.labelValue = strings.Trim(strings.TrimSpace(parts[1]), `"`)
+		}
+	}
+	return f
+}
+
+func (f filter) match(job, target string, labels []uiLabel) bool {
+	if f.labelName != "" {
+		found := false
+		for _, l := range labels {
+			if l.Name == f.labelName && l.Value == f.labelValue {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.query == "" {
+		return true
+	}
+	q := strings.ToLower(f.query)
+	if strings.Contains(strings.ToLower(job), q) || strings.Contains(strings.ToLower(target), q) {
+		return true
+	}
+	for _, l := range labels {
+		if strings.Contains(strings.ToLower(l.Name), q) || strings.Contains(strings.ToLower(l.Value), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveUI serves the HTML page listing the targets of every backend
+func (s *Server) serveUI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	f := newFilter(r)
+
+	s.mu.RLock()
+	page := struct {
+		Query    string
+		Label    string
+		Backends []uiBackend
+	}{
+		Query: r.FormValue("q"),
+		Label: r.FormValue("label"),
+	}
+	for _, inst := range s.configured {
+		b := uiBackend{
+			Status:  backends.GetStatus(inst.Backend.GetName(), inst.Backend.GetID()),
+			Changed: s.changed[inst.Key],
+		}
+		for _, job := range s.data[inst.Key].Jobs {
+			j := uiJob{Name: job.JobName}
+			for _, sc := range job.StaticConfigs {
+				labels := make([]uiLabel, 0, len(sc.Labels))
+				for k, v := range sc.Labels {
+					labels = append(labels, uiLabel{k, v})
+				}
+				sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+				for _, target := range sc.Targets {
+					if f.match(job.JobName, target, labels) {
+						j.Targets = append(j.Targets, uiTarget{target, labels})
+					}
+				}
+			}
+			if len(j.Targets) > 0 {
+				b.Jobs = append(b.Jobs, j)
+			}
+		}
+		page.Backends = append(page.Backends, b)
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := ui.Execute(w, page)
+	if err != nil {
+		log.Errorf("failed to render web UI: %s", err)
+	}
+}
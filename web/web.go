@@ -0,0 +1,192 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+	"github.com/cryptobioz/prometheus-service-discovery/output"
+)
+
+// document is a rendered HTTP SD response
+type document struct {
+	body []byte
+	etag string
+}
+
+// Server serves the discovered targets over HTTP
+type Server struct {
+	mux *http.ServeMux
+
+	mu         sync.RWMutex
+	combined   document
+	backends   map[string]document
+	data       map[string]backends.BackendData
+	changed    map[string]time.Time
+	configured []config.Backend
+	deadline   time.Time
+	ready      bool
+}
+
+// New creates a new HTTP server
+func New() *Server {
+	s := &Server{
+		mux:      http.NewServeMux(),
+		backends: make(map[string]document),
+		data:     make(map[string]backends.BackendData),
+		changed:  make(map[string]time.Time),
+	}
+	s.combined = newDocument([]output.TargetGroup{})
+
+	s.mux.HandleFunc("/sd", s.serveCombined)
+	s.mux.HandleFunc("/sd/", s.serveBackend)
+	s.mux.HandleFunc("/healthz", s.serveHealthz)
+	s.mux.HandleFunc("/ready", s.serveReady)
+	s.mux.HandleFunc("/status", s.serveStatus)
+	s.mux.HandleFunc("/", s.serveUI)
+	return s
+}
+
+// SetBackends declares the configured backend instances, so that their
+// URL answers with an empty list until their first discovery
+func (s *Server) SetBackends(instances []config.Backend) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.configured = append([]config.Backend(nil), instances...)
+	sort.Slice(s.configured, func(i, j int) bool {
+		return s.configured[i].Key < s.configured[j].Key
+	})
+
+	wanted := make(map[string]bool)
+	for _, inst := range instances {
+		wanted[inst.Key] = true
+		if _, ok := s.backends[inst.Key]; !ok {
+			s.backends[inst.Key] = newDocument([]output.TargetGroup{})
+		}
+	}
+	for key := range s.backends {
+		if !wanted[key] {
+			delete(s.backends, key)
+			delete(s.data, key)
+			delete(s.changed, key)
+		}
+	}
+}
+
+// Update renders the HTTP SD responses for the given backends data. The
+// configured backends missing from data, like the ones whose stale targets
+// expired, answer with an empty list.
+func (s *Server) Update(data map[string]backends.BackendData) {
+	rendered := make(map[string]document, len(data))
+	for key, d := range data {
+		rendered[key] = newDocument(output.TargetGroups(map[string]backends.BackendData{key: d}))
+	}
+	combined := newDocument(output.TargetGroups(data))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for key, doc := range rendered {
+		if s.backends[key].etag != doc.etag {
+			s.changed[key] = now
+		}
+		s.backends[key] = doc
+		s.data[key] = data[key]
+	}
+	for _, inst := range s.configured {
+		if _, ok := data[inst.Key]; ok {
+			continue
+		}
+		if _, ok := s.data[inst.Key]; ok {
+			s.changed[inst.Key] = now
+		}
+		s.backends[inst.Key] = newDocument([]output.TargetGroup{})
+		delete(s.data, inst.Key)
+	}
+	s.combined = combined
+}
+
+// Handle registers an additional handler on the server
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe listens on the given address and serves requests
+func (s *Server) ListenAndServe(addr string) error {
+	log.Infof("Listening on %s", addr)
+	return http.ListenAndServe(addr, s)
+}
+
+// serveCombined serves the targets of every backend
+func (s *Server) serveCombined(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	doc := s.combined
+	s.mu.RUnlock()
+
+	doc.serve(w, r)
+}
+
+// serveBackend serves the targets of a single backend instance, at
+// /sd/{backend}/{id}
+func (s *Server) serveBackend(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/sd/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.RLock()
+	doc, ok := s.backends[config.BackendKey(parts[0], parts[1])]
+	s.mu.RUnlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown %s backend `%s`", parts[0], parts[1]), http.StatusNotFound)
+		return
+	}
+
+	doc.serve(w, r)
+}
+
+func newDocument(groups []output.TargetGroup) document {
+	body, _ := json.Marshal(groups)
+	return document{
+		body: body,
+		etag: fmt.Sprintf("\"%x\"", sha256.Sum256(body)),
+	}
+}
+
+func (doc document) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("ETag", doc.etag)
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, etag := range strings.Split(match, ",") {
+			etag = strings.TrimSpace(etag)
+			if etag == doc.etag || etag == "*" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(doc.body)
+}
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+)
+
+type fakeBackend struct {
+	name, id string
+}
+
+func (b fakeBackend) New() error { return nil }
+func (b fakeBackend) Discover(context.Context) ([]backends.JobConfig, error) {
+	return nil, nil
+}
+func (b fakeBackend) GetName() string { return b.name }
+func (b fakeBackend) GetID() string   { return b.id }
+
+func get(t *testing.T, s *Server, path string) string {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	if w.Code != 200 {
+		t.Fatalf("GET %s: unexpected status %d", path, w.Code)
+	}
+	return w.Body.String()
+}
+
+func TestUpdateExpiredBackend(t *testing.T) {
+	key := config.BackendKey("static", "a")
+	s := New()
+	s.SetBackends([]config.Backend{{
+		Key:     key,
+		Backend: fakeBackend{"static", "a"},
+	}})
+
+	s.Update(map[string]backends.BackendData{
+		key: {
+			Backend: "static",
+			ID:      "a",
+			Jobs: []backends.JobConfig{{
+				JobName: "a",
+				StaticConfigs: []backends.StaticConfig{{
+					Targets: []string{"h:1"},
+					Labels:  map[string]string{backends.StaleLabel: "true"},
+				}},
+			}},
+		},
+	})
+	for _, path := range []string{"/sd", "/sd/static/a", "/"} {
+		if body := get(t, s, path); !strings.Contains(body, "h:1") {
+			t.Errorf("GET %s: expected target h:1, got %s", path, body)
+		}
+	}
+
+	// The stale targets expired: the backend is missing from the data
+	s.Update(map[string]backends.BackendData{})
+	for _, path := range []string{"/sd", "/sd/static/a"} {
+		if body := get(t, s, path); body != "[]" {
+			t.Errorf("GET %s: expected an empty list, got %s", path, body)
+		}
+	}
+	if body := get(t, s, "/"); strings.Contains(body, "h:1") {
+		t.Errorf("GET /: expected no target, got %s", body)
+	}
+	if _, ok := s.data[key]; ok {
+		t.Errorf("expected the data of %s to be cleared", key)
+	}
+}
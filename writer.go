@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/cryptobioz/prometheus-service-discovery/backends"
+	"github.com/cryptobioz/prometheus-service-discovery/config"
+	"github.com/cryptobioz/prometheus-service-discovery/output"
+)
+
+// writer writes the outputs in its own goroutine, so that slow writes, like
+// the retries of the Prometheus reloads, do not delay the HTTP server, the
+// stale targets expiry or the configuration reloads. Only the last data is
+// written: the changes received while writing are coalesced.
+type writer struct {
+	mu          sync.Mutex
+	outputs     config.Outputs
+	data        map[string]backends.BackendData
+	debounce    time.Duration
+	minInterval time.Duration
+	maxDelay    time.Duration
+
+	changes chan struct{}
+	done    chan struct{}
+}
+
+func newWriter() *writer {
+	return &writer{
+		changes: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// configure applies the write settings of the configuration to the next
+// changes
+func (w *writer) configure(debounce, minInterval, maxDelay time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.debounce, w.minInterval, w.maxDelay = debounce, minInterval, maxDelay
+}
+
+// changed records the data to write to the outputs
+func (w *writer) changed(outputs config.Outputs, data map[string]backends.BackendData) {
+	w.mu.Lock()
+	w.outputs, w.data = outputs, data
+	w.mu.Unlock()
+
+	select {
+	case w.changes <- struct{}{}:
+	default:
+	}
+}
+
+// run writes the changes when the write settings allow it, until ctx is
+// cancelled. A running write is cancelled with ctx.
+func (w *writer) run(ctx context.Context) {
+	defer close(w.done)
+
+	var s writeScheduler
+	for {
+		select {
+		case <-w.changes:
+			w.mu.Lock()
+			s.configure(w.debounce, w.minInterval, w.maxDelay)
+			w.mu.Unlock()
+			s.changed(time.Now())
+		case <-s.timer():
+			s.written(time.Now())
+			w.write(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// wait waits for run to return
+func (w *writer) wait() {
+	<-w.done
+}
+
+// write writes the last changed data to every output
+func (w *writer) write(ctx context.Context) error {
+	w.mu.Lock()
+	outputs, data := w.outputs, w.data
+	w.mu.Unlock()
+
+	err := output.Write(ctx, outputs, data)
+	if err != nil {
+		log.Errorf("failed to write config file: %s", err)
+	}
+	return err
+}